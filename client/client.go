@@ -0,0 +1,173 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"podcompose/common"
+	"strings"
+)
+
+// waitQuery makes the agent answer once the asynchronous operation is finished
+const waitQuery = "?wait=true"
+
+// Client calls the agent management api
+type Client struct {
+	baseUrl    string
+	httpClient *http.Client
+}
+
+// Error is returned when the agent answers with a non 2xx status, Message is the "message" of the body
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("agent api error, status: %d, message: %s", e.StatusCode, e.Message)
+}
+
+// NewClient creates a client for the agent listening on baseUrl, e.g. http://localhost:8080
+func NewClient(baseUrl string) *Client {
+	return NewClientWithHttpClient(baseUrl, http.DefaultClient)
+}
+
+func NewClientWithHttpClient(baseUrl string, httpClient *http.Client) *Client {
+	return &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, common.EndPointAgentHealth, nil, nil)
+}
+
+// Start starts the compose when the agent is not in auto start mode
+func (c *Client) Start(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, common.EndPointAgentStart+waitQuery, nil, nil)
+}
+
+// Stop removes all pods and volumes, the agent keeps running
+func (c *Client) Stop(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, common.EndPointAgentStop, nil, nil)
+}
+
+// Shutdown stops the compose and removes every resource of the session, including the agent
+func (c *Client) Shutdown(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, common.EndPointAgentShutdown, nil, nil)
+}
+
+// Restart restarts the pods and every pod depending on them
+func (c *Client) Restart(ctx context.Context, podNames ...string) error {
+	return c.do(ctx, http.MethodPost, common.EndPointAgentRestart+waitQuery, common.RestartRequest(podNames), nil)
+}
+
+// SwitchData recreates the volumes of the volume group and restarts the pods using them
+func (c *Client) SwitchData(ctx context.Context, volumeGroupName string) error {
+	return c.do(ctx, http.MethodPost, common.EndPointAgentSwitchData+waitQuery, &common.SwitchDataRequest{Name: volumeGroupName}, nil)
+}
+
+// SnapshotVolume copies the volume into the named snapshot, an existing snapshot of the name is replaced
+func (c *Client) SnapshotVolume(ctx context.Context, volumeName string, snapshot string) error {
+	return c.do(ctx, http.MethodPost, volumePath(volumeName, "snapshot", snapshot), nil, nil)
+}
+
+// RestoreVolume restarts the pods using the volume with the data of the named snapshot
+func (c *Client) RestoreVolume(ctx context.Context, volumeName string, snapshot string) error {
+	return c.do(ctx, http.MethodPost, volumePath(volumeName, "restore", snapshot), nil, nil)
+}
+
+// ExportVolume streams the files of the volume as a tar archive, the caller closes it
+func (c *Client) ExportVolume(ctx context.Context, volumeName string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, common.EndPointAgentVolumes+"/"+url.PathEscape(volumeName)+"/export", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func volumePath(volumeName string, action string, snapshot string) string {
+	return common.EndPointAgentVolumes + "/" + url.PathEscape(volumeName) + "/" + action + waitQuery + "&snapshot=" + url.QueryEscape(snapshot)
+}
+
+// Ingress exposes the pod ports on the host, see common.IngressRequest
+func (c *Client) Ingress(ctx context.Context, ingress common.IngressRequest) error {
+	return c.do(ctx, http.MethodPost, common.EndPointAgentIngress+waitQuery, ingress, nil)
+}
+
+// RunTaskGroup runs a task group and waits for it to finish
+func (c *Client) RunTaskGroup(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, common.EndPointAgentTaskGroup, &common.TaskGroupRequest{Name: name}, nil)
+}
+
+func (c *Client) Info(ctx context.Context) (*common.Info, error) {
+	var info common.Info
+	if err := c.do(ctx, http.MethodGet, common.EndPointAgentInfo, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) Stats(ctx context.Context) ([]common.PodStats, error) {
+	var stats []common.PodStats
+	if err := c.do(ctx, http.MethodGet, common.EndPointAgentStats, nil, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, requestBody interface{}, responseBody interface{}) error {
+	resp, err := c.send(ctx, method, path, requestBody)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if responseBody == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(responseBody)
+}
+
+// send returns the response of a 2xx status, the caller closes its body
+func (c *Client) send(ctx context.Context, method string, path string, requestBody interface{}) (*http.Response, error) {
+	var body io.Reader
+	if requestBody != nil {
+		b, err := json.Marshal(requestBody)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if requestBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		var message common.Message
+		if err := json.Unmarshal(b, &message); err != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(b))
+		}
+		return nil, &Error{
+			StatusCode: resp.StatusCode,
+			Message:    message.Message,
+		}
+	}
+	return resp, nil
+}
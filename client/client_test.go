@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"podcompose/common"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(common.EndPointAgentRestart, func(w http.ResponseWriter, r *http.Request) {
+		var restartRequest common.RestartRequest
+		if err := json.NewDecoder(r.Body).Decode(&restartRequest); err != nil || len(restartRequest) != 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(&common.Message{Message: "pod name:" + restartRequest[1] + " is not exist"})
+	})
+	mux.HandleFunc(common.EndPointAgentInfo, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&common.Info{SessionId: "test", IsReady: true})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c := NewClient(server.URL + "/")
+	ctx := context.Background()
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SessionId != "test" || !info.IsReady {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	err = c.Restart(ctx, "nginx", "mysql")
+	var apiError *Error
+	if !errors.As(err, &apiError) {
+		t.Fatalf("expect api error, got %v", err)
+	}
+	if apiError.StatusCode != http.StatusBadRequest || apiError.Message != "pod name:mysql is not exist" {
+		t.Fatalf("unexpected api error: %+v", apiError)
+	}
+}
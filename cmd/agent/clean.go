@@ -6,7 +6,7 @@ import (
 )
 
 type Cleaner struct {
-	dockerProvider *docker.DockerProvider
+	dockerProvider docker.Runtime
 	sessionId      string
 }
 
@@ -4,6 +4,7 @@ import (
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"os"
+	"path/filepath"
 	"podcompose/common"
 	"podcompose/config"
 	"podcompose/event"
@@ -16,7 +17,6 @@ func main() {
 	sessionId := os.Getenv(common.LabelSessionID)
 	hostContextPath := os.Getenv(common.EnvHostContextPath)
 	runner, err := NewStarter(common.AgentContextPath, sessionId, hostContextPath)
-	volume, err := NewVolume(common.AgentContextPath, sessionId)
 	cleaner, err := NewCleaner(sessionId)
 	handleError(err)
 	rootCmd := &cobra.Command{
@@ -29,25 +29,6 @@ func main() {
 			cleaner.clear()
 		},
 	}
-	prepareVolumeCmd := &cobra.Command{
-		Use: "prepareVolume",
-		Run: func(cmd *cobra.Command, args []string) {
-			handleError(setConfig(rootCmd))
-			err = volume.copyDataToVolume(volume.GetConfig().Volumes)
-			handleError(err)
-		},
-	}
-	prepareVolumeGroupCmd := &cobra.Command{
-		Use: "prepareVolumeGroup",
-		Run: func(cmd *cobra.Command, args []string) {
-			handleError(setConfig(rootCmd))
-			selectGroupIndex, err := cmd.Flags().GetInt("selectGroupIndex")
-			handleError(err)
-			err = volume.copyDataToVolumeGroup(selectGroupIndex)
-			handleError(err)
-		},
-	}
-	prepareVolumeGroupCmd.Flags().IntP("selectGroupIndex", "s", 0, "select volume group")
 	startCmd := &cobra.Command{
 		Use: "start",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -56,6 +37,14 @@ func main() {
 			if err != nil {
 				handleError(err)
 			}
+			err = event.Bus.PersistHistory(filepath.Join(common.AgentLogPath, common.EventHistoryFileName))
+			if err != nil {
+				zap.L().Sugar().Errorf("persist event history error: %s", err)
+			}
+			if runner.compose.GetConfig().EventFormat == event.FormatCloudEvents {
+				event.Bus.UseCloudEvents(runner.compose.GetSessionId())
+			}
+			runner.compose.StartEventSinks(event.Bus)
 			autoStart, err := cmd.Flags().GetBool("autoStart")
 			if err != nil {
 				handleError(err)
@@ -63,9 +52,7 @@ func main() {
 			if autoStart {
 				zap.L().Info("Auto start mode is enable, start compose now")
 				go func() {
-					if err = runner.start(); err != nil {
-						handleError(err)
-					}
+					handleError(runner.compose.AutoStart(runner.start))
 				}()
 			}
 			if err = runner.startWebServer(); err != nil {
@@ -92,8 +79,6 @@ func main() {
 	prepareIngressVolumeCmd.Flags().StringArrayP("ports", "p", []string{}, "service port mapping")
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(cleanCmd)
-	rootCmd.AddCommand(prepareVolumeCmd)
-	rootCmd.AddCommand(prepareVolumeGroupCmd)
 	rootCmd.AddCommand(prepareIngressVolumeCmd)
 	rootCmd.PersistentFlags().String("fromConfigJson", "", "compose config json")
 	err = rootCmd.Execute()
@@ -4,16 +4,14 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v2"
 	"net/http"
 	"os"
 	"path/filepath"
-	"podcompose/cmd/agent/ingress"
-	"podcompose/cmd/agent/server"
 	"podcompose/common"
 	"podcompose/compose"
-	"strconv"
-	"strings"
+	"podcompose/compose/ingress"
+	"podcompose/server"
+	"podcompose/trace"
 	"time"
 )
 
@@ -45,40 +43,22 @@ func NewStarter(workspace string, sessionId string, hostContextPath string) (*St
 	}, nil
 }
 
-func (s *Starter) start() error {
+func (s *Starter) start(ctx context.Context) (err error) {
 	if s.isStarted {
 		return errors.New("compose is started")
 	}
 	defer func() {
 		s.isStarted = true
 	}()
-	ctx := context.Background()
-	// create volume
-	err := s.compose.CreateVolumes(ctx, s.compose.GetConfig().Volumes)
-	if err != nil {
-		return err
-	}
-	err = s.agent.StartAgentForSetVolume(ctx)
-	if err != nil {
-		return err
-	}
-	// create volume group default
-	if len(s.compose.GetConfig().VolumeGroups) > 0 {
-		defaultGroup := s.compose.GetConfig().VolumeGroups[0]
-		err := s.compose.CreateVolumesWithGroup(ctx, defaultGroup)
-		if err != nil {
-			return err
-		}
-		err = s.agent.StartAgentForSetVolumeGroup(ctx, 0)
-		if err != nil {
-			return err
-		}
-	}
-	return s.compose.StartPods(ctx)
+	ctx, span := trace.Start(ctx, "start")
+	defer func() {
+		span.Finish(err)
+		s.compose.WriteTrace()
+	}()
+	return s.compose.Start(ctx, s.agent)
 }
-func (s *Starter) stop() error {
+func (s *Starter) stop(ctx context.Context) error {
 	if s.compose.IsReady() {
-		ctx := context.Background()
 		s.compose.StopPods(ctx)
 		s.isStarted = false
 	} else {
@@ -105,6 +85,7 @@ func (s *Starter) startWebServer() error {
 	if err := srv.Shutdown(ctx); err != nil {
 		return err
 	}
+	s.compose.StopEventSinks()
 	// catching ctx.Done(). timeout of 5 seconds.
 	select {
 	case <-ctx.Done():
@@ -115,27 +96,11 @@ func (s *Starter) startWebServer() error {
 }
 
 func (s *Starter) prepareIngressVolume(servicePortMap map[string]string) error {
-	config := ingress.NewEnvoyConfig()
-	for serviceName, portMapping := range servicePortMap {
-		portMappingSplit := strings.SplitN(portMapping, ":", 2)
-		sourcePort, err := strconv.Atoi(portMappingSplit[0])
-		if err != nil {
-			return err
-		}
-		targetPort, err := strconv.Atoi(portMappingSplit[1])
-		if err != nil {
-			return err
-		}
-		err = config.AddExposePort(serviceName, sourcePort, targetPort)
-		if err != nil {
-			return err
-		}
-	}
-	marshal, err := yaml.Marshal(config)
+	marshal, err := ingress.BuildEnvoyConfig(servicePortMap)
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(filepath.Join(common.AgentVolumePath, common.IngressVolumeName, "envoy.yaml"), marshal, 0766)
+	err = os.WriteFile(filepath.Join(common.AgentVolumePath, common.IngressVolumeName, ingress.EnvoyConfigFileName), marshal, 0766)
 	if err != nil {
 		return err
 	}
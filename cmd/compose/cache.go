@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gosuri/uitable"
+	"go.uber.org/zap"
+	"podcompose/docker"
+	"time"
+)
+
+type CacheCmd struct {
+	dockerProvider docker.Runtime
+}
+
+func NewCacheCmd() (*CacheCmd, error) {
+	dockerProvider, err := docker.NewDockerProvider()
+	if err != nil {
+		return nil, err
+	}
+	return &CacheCmd{
+		dockerProvider: dockerProvider,
+	}, nil
+}
+
+func (c *CacheCmd) Ls() error {
+	volumes, err := c.dockerProvider.FindAllCacheVolumes(context.Background())
+	if err != nil {
+		return err
+	}
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.AddRow("NAME", "SOURCE", "CREATED")
+	for _, v := range volumes {
+		table.AddRow(v.Name, v.Labels[docker.CacheSourceLabel], v.CreatedAt)
+	}
+	fmt.Println(table)
+	return nil
+}
+
+// Prune removes the cache volumes created before olderThan, every one when it is 0,
+// the ones still mounted by a session are kept
+func (c *CacheCmd) Prune(olderThan time.Duration) error {
+	ctx := context.Background()
+	volumes, err := c.dockerProvider.FindAllCacheVolumes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if olderThan > 0 {
+			createdAt, err := time.Parse(time.RFC3339, v.CreatedAt)
+			if err == nil && time.Since(createdAt) < olderThan {
+				continue
+			}
+		}
+		zap.L().Sugar().Infof("remove cache volume:%s", v.Name)
+		if err := c.dockerProvider.RemoveCacheVolume(ctx, v.Name); err != nil {
+			zap.L().Sugar().Warnf("keep cache volume %s: %v", v.Name, err)
+		}
+	}
+	return nil
+}
@@ -7,7 +7,7 @@ import (
 )
 
 type CleanCmd struct {
-	dockerProvider *docker.DockerProvider
+	dockerProvider docker.Runtime
 	plist          *Plist
 }
 
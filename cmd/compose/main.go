@@ -75,10 +75,51 @@ func main() {
 		},
 	}
 	cleanCmd.Flags().BoolP("all", "a", false, "all tpc")
+	cacheCmd := &cobra.Command{
+		Use: "cache",
+	}
+	cacheLsCmd := &cobra.Command{
+		Use: "ls",
+		Run: func(cmd *cobra.Command, args []string) {
+			cache, err := NewCacheCmd()
+			handleError(err)
+			handleError(cache.Ls())
+		},
+	}
+	cachePruneCmd := &cobra.Command{
+		Use: "prune",
+		Run: func(cmd *cobra.Command, args []string) {
+			olderThan, err := cmd.Flags().GetDuration("olderThan")
+			handleError(err)
+			cache, err := NewCacheCmd()
+			handleError(err)
+			handleError(cache.Prune(olderThan))
+		},
+	}
+	cachePruneCmd.Flags().Duration("olderThan", 0, "only remove the cache volumes created before, e.g. 168h")
+	cacheCmd.AddCommand(cacheLsCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	volumeCmd := &cobra.Command{
+		Use: "volume",
+	}
+	volumeExportCmd := &cobra.Command{
+		Use: "export <session> <volume> <dir|file.tar>",
+		Run: func(cmd *cobra.Command, args []string) {
+			all, err := cmd.Flags().GetBool("all")
+			handleError(err)
+			volume, err := NewVolumeCmd()
+			handleError(err)
+			handleError(volume.Export(args, all))
+		},
+	}
+	volumeExportCmd.Flags().BoolP("all", "a", false, "export every volume of the session, args are <session> <dir|file.tar>")
+	volumeCmd.AddCommand(volumeExportCmd)
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(shutdownCmd)
 	rootCmd.AddCommand(psCmd)
 	rootCmd.AddCommand(cleanCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(volumeCmd)
 	rootCmd.PersistentFlags().String("fromConfigJson", "", "compose config json")
 	err := rootCmd.Execute()
 	handleError(err)
@@ -24,6 +24,7 @@ func NewStartCmd(contextPath string, name string) *StartCmd {
 
 type ConfigDump struct {
 	SessionId    string
+	Host         string
 	ManagerPort  string
 	EventBusPort string
 }
@@ -46,10 +47,15 @@ func (s *StartCmd) Start(autoStart bool, configDumpFile string, bootInDocker boo
 	if err != nil {
 		return err
 	}
-	zap.L().Sugar().Infof("StartCmd test compose success, name is: %s, managed port is: %s, event bus port is:%s", testCompose.GetSessionId(), agentPort, eventBusPort)
+	host, err := testCompose.GetHost(ctx)
+	if err != nil {
+		return err
+	}
+	zap.L().Sugar().Infof("StartCmd test compose success, name is: %s, host is: %s, managed port is: %s, event bus port is:%s", testCompose.GetSessionId(), host, agentPort, eventBusPort)
 	if configDumpFile != "" {
 		configDump := &ConfigDump{
 			SessionId:    testCompose.GetSessionId(),
+			Host:         host,
 			ManagerPort:  agentPort,
 			EventBusPort: eventBusPort,
 		}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"go.uber.org/zap"
+	"podcompose/common"
 	"podcompose/compose"
 	"podcompose/docker"
 )
@@ -13,7 +14,7 @@ type ShutdownCmd struct {
 	plist  *Plist
 }
 type SampleCompose struct {
-	dockerProvider *docker.DockerProvider
+	dockerProvider docker.Runtime
 	sessionId      string
 }
 
@@ -21,11 +22,19 @@ func (s SampleCompose) IsReady() bool {
 	return false
 }
 
+func (s SampleCompose) InProcess() bool {
+	return false
+}
+
+func (s SampleCompose) GetContextPath() string {
+	panic("not need")
+}
+
 func (s SampleCompose) GetContextPathForMount() string {
 	panic("not need")
 }
 
-func (s SampleCompose) GetDockerProvider() *docker.DockerProvider {
+func (s SampleCompose) GetRuntime() docker.Runtime {
 	return s.dockerProvider
 }
 
@@ -36,7 +45,15 @@ func (s SampleCompose) GetSessionId() string {
 func (s SampleCompose) GetConfig() *compose.ComposeConfig {
 	panic("not need")
 }
-func NewSampleCompose(sessionId string, dockerProvider *docker.DockerProvider) (*SampleCompose, error) {
+
+func (s SampleCompose) GetVolumeInfos() []common.VolumeInfo {
+	panic("not need")
+}
+
+func (s SampleCompose) SetVolumeSource(name string, source string) {
+	panic("not need")
+}
+func NewSampleCompose(sessionId string, dockerProvider docker.Runtime) (*SampleCompose, error) {
 	return &SampleCompose{
 		dockerProvider: dockerProvider,
 		sessionId:      sessionId,
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"podcompose/docker"
+)
+
+type VolumeCmd struct {
+	dockerProvider docker.Runtime
+}
+
+func NewVolumeCmd() (*VolumeCmd, error) {
+	dockerProvider, err := docker.NewDockerProvider()
+	if err != nil {
+		return nil, err
+	}
+	return &VolumeCmd{
+		dockerProvider: dockerProvider,
+	}, nil
+}
+
+// Export writes the volume of the session to a directory or a .tar file, every volume of the session
+// when all is set, args are the session, the volume unless all is set and the destination
+func (v *VolumeCmd) Export(args []string, all bool) error {
+	ctx := context.Background()
+	if all {
+		if len(args) != 2 {
+			return errors.New("usage: tpc volume export <session> --all <dir|file.tar>")
+		}
+		zap.L().Sugar().Infof("export volumes of %s to %s", args[0], args[1])
+		return docker.ExportVolumes(ctx, v.dockerProvider, args[0], args[1], nil)
+	}
+	if len(args) != 3 {
+		return errors.New("usage: tpc volume export <session> <volume> <dir|file.tar>")
+	}
+	zap.L().Sugar().Infof("export volume %s of %s to %s", args[1], args[0], args[2])
+	return docker.ExportVolumeTo(ctx, v.dockerProvider, args[1], args[0], args[2])
+}
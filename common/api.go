@@ -0,0 +1,47 @@
+package common
+
+import "time"
+
+// Message is the body of every agent api response without a payload, and of every error
+type Message struct {
+	Message string `json:"message"`
+}
+
+type TaskGroupRequest struct {
+	Name string `json:"name"`
+}
+
+type SwitchDataRequest struct {
+	Name string `json:"name"`
+}
+
+// RestartRequest is the list of pod names to restart
+type RestartRequest []string
+
+// IngressRequest maps a pod name to "servicePort:hostPort", a host port <= 0 removes the ingress
+type IngressRequest map[string]string
+
+// IngressSpec is the body of PUT /v1/ingresses/{name}, name is the pod exposing the port
+type IngressSpec struct {
+	ServicePort int `json:"servicePort"`
+	HostPort    int `json:"hostPort"`
+}
+
+const OperationStatusQueued = "queued"
+const OperationStatusRunning = "running"
+const OperationStatusSucceeded = "succeeded"
+const OperationStatusFailed = "failed"
+const OperationStatusCanceled = "canceled"
+
+// OperationInfo is the state of an asynchronous api call, returned with 202 by the long-running endpoints
+type OperationInfo struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Events counts the events published by the operation, Progress is the type of the last one
+	Events     int        `json:"events"`
+	Progress   string     `json:"progress,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreateTime time.Time  `json:"createTime"`
+	EndTime    *time.Time `json:"endTime,omitempty"`
+}
@@ -6,8 +6,10 @@ const TpcName = "TPC_NAME"
 const AgentContextPath = "/home/context/"
 const AgentLogPath = "/home/logs/"
 const AgentVolumePath = "/home/volumes/"
+const AgentCertPath = "/home/certs/"
 const EndPointAgentStart = "/start"
-const EndPointAgentHealth = "/heath"
+const EndPointAgentHealth = "/health"
+const EndPointAgentHealthAlias = "/heath"
 const EndPointAgentShutdown = "/shutdown"
 const EndPointAgentTaskGroup = "/taskGroup"
 const EndPointAgentStop = "/stop"
@@ -15,6 +17,16 @@ const EndPointAgentSwitchData = "/switch"
 const EndPointAgentRestart = "/restart"
 const EndPointAgentIngress = "/ingress"
 const EndPointAgentInfo = "/info"
+const EndPointAgentStats = "/stats"
+const EndPointAgentMetrics = "/metrics"
+const EndPointAgentTrace = "/trace"
+const EndPointAgentEvents = "/events"
+const EndPointAgentEventHistory = "/events/history"
+const EndPointAgentOperations = "/operations"
+
+// EndPointAgentVolumes is followed by /{name}/snapshot or /{name}/restore, the snapshot name is the snapshot query,
+// or by /{name}/export to download the files of the volume as a tar archive
+const EndPointAgentVolumes = "/volumes"
 const ServerAgentPort = "80"
 const ServerAgentEventBusPort = "7070"
 
@@ -23,9 +35,14 @@ const LabelPodName = "POD_NAME"
 const LabelContainerName = "CONTAINER_NAME"
 
 const EnvHostContextPath = "HOST_CONTEXT_PATH"
+const EnvHostRuntimeSocket = "HOST_RUNTIME_SOCKET"
 const ConfigFileName = "compose.yaml"
 
 const IngressVolumeName = "ingress"
 const SystemLogVolumeName = "tpc_system_log"
+const ContextVolumeName = "tpc_context"
+const CertVolumeName = "tpc_certs"
+const StatsSummaryFileName = "stats_summary.json"
+const EventHistoryFileName = "events.jsonl"
 const InitExitTimeOut = 60000
 const ContainerNamePrefix = "tpc_"
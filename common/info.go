@@ -26,4 +26,34 @@ type ContainerInfo struct {
 type VolumeInfo struct {
 	Name     string
 	VolumeId string
+	// VolumeGroup is the group whose data the volume holds, empty while it is being switched
+	VolumeGroup string
+}
+
+type ResourceUsage struct {
+	CpuPercent  float64
+	MemoryUsage uint64
+	MemoryLimit uint64
+	NetworkRx   uint64
+	NetworkTx   uint64
+	BlockRead   uint64
+	BlockWrite  uint64
+}
+type PodStats struct {
+	Name string
+	ResourceUsage
+	ContainerStats []ContainerStats
+}
+type ContainerStats struct {
+	Name        string
+	ContainerId string
+	ResourceUsage
+}
+type StatsSummary struct {
+	SessionId string
+	Pods      []PodStatsSummary
+}
+type PodStatsSummary struct {
+	Name string
+	Peak ResourceUsage
 }
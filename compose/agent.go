@@ -12,19 +12,29 @@ import (
 	"podcompose/event"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Agent struct {
 	composeProvider    ComposeProvider
+	lock               sync.RWMutex
 	servicePortInfoMap map[string]string
 }
 
 type ComposeProvider interface {
+	// GetContextPath is where the context is readable by this process, GetContextPathForMount where the engine sees it
+	GetContextPath() string
 	GetContextPathForMount() string
-	GetDockerProvider() *docker.DockerProvider
+	GetRuntime() docker.Runtime
 	GetSessionId() string
 	GetConfig() *ComposeConfig
 	IsReady() bool
+	// InProcess is true when the agent work is done in this process instead of agent containers
+	InProcess() bool
+	// SetVolumeSource mounts source, e.g. a read only cache volume, where the volume of the name is mounted
+	SetVolumeSource(name string, source string)
+	// GetVolumeInfos are the volumes of the volume groups with the group each one holds
+	GetVolumeInfos() []common.VolumeInfo
 }
 
 func NewAgent(composeProvider ComposeProvider) *Agent {
@@ -39,6 +49,8 @@ func (a *Agent) GetSessionId() string {
 }
 
 func (a *Agent) getIngressInfos() []common.IngressInfo {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
 	ingresses := make([]common.IngressInfo, 0)
 	for name, portPair := range a.servicePortInfoMap {
 		pair := strings.Split(portPair, ":")
@@ -52,18 +64,9 @@ func (a *Agent) getIngressInfos() []common.IngressInfo {
 	return ingresses
 }
 func (a *Agent) GetInfo() common.Info {
-	var volumeInfos []common.VolumeInfo
-	if len(a.composeProvider.GetConfig().VolumeGroups) > 0 {
-		volumeInfos := make([]common.VolumeInfo, len(a.composeProvider.GetConfig().VolumeGroups[0].Volumes))
-		for i, v := range a.composeProvider.GetConfig().VolumeGroups[0].Volumes {
-			volumeInfos[i] = common.VolumeInfo{
-				Name:     v.Name,
-				VolumeId: v.Name + "_" + genSessionId(),
-			}
-		}
-	}
+	volumeInfos := a.composeProvider.GetVolumeInfos()
 	ctx := context.Background()
-	containers, _ := a.composeProvider.GetDockerProvider().FindAllContainersWithSessionId(ctx, a.composeProvider.GetSessionId())
+	containers, _ := a.composeProvider.GetRuntime().FindAllContainersWithSessionId(ctx, a.composeProvider.GetSessionId())
 	podInfos := make([]common.PodInfo, len(a.composeProvider.GetConfig().Pods))
 	for i, p := range a.composeProvider.GetConfig().Pods {
 		containerInfos := make([]common.ContainerInfo, 0)
@@ -85,7 +88,7 @@ func (a *Agent) GetInfo() common.Info {
 	}
 
 	return common.Info{
-		SessionId:   genSessionId(),
+		SessionId:   a.GetSessionId(),
 		VolumeInfos: volumeInfos,
 		PodInfos:    podInfos,
 		Ingresses:   a.getIngressInfos(),
@@ -94,8 +97,7 @@ func (a *Agent) GetInfo() common.Info {
 }
 func (a *Agent) StartAgentForServer(ctx context.Context, autoStart bool, bootInDocker bool) (docker.Container, error) {
 	agentMounts := make([]docker.ContainerMount, 0)
-	agentMounts = append(agentMounts, docker.BindMount("/var/run/docker.sock", "/var/run/docker.sock"))
-	agentMounts = append(agentMounts, docker.BindMount(a.composeProvider.GetContextPathForMount(), common.AgentContextPath))
+	agentMounts = append(agentMounts, contextMount(a.composeProvider.GetRuntime(), a.GetSessionId(), a.composeProvider.GetContextPathForMount()))
 	agentMounts = append(agentMounts, docker.VolumeMount(common.SystemLogVolumeName+"_"+a.GetSessionId(), common.AgentLogPath))
 	containerName := common.ContainerNamePrefix + "agent_" + a.composeProvider.GetSessionId()
 	var waitStrategy wait.Strategy
@@ -108,7 +110,8 @@ func (a *Agent) StartAgentForServer(ctx context.Context, autoStart bool, bootInD
 			WithPort(common.ServerAgentPort + "/tcp").
 			WithMethod("GET")
 	}
-	return a.composeProvider.GetDockerProvider().RunContainer(ctx, docker.ContainerRequest{
+	runtime := a.composeProvider.GetRuntime()
+	return runtime.RunContainer(ctx, withRuntime(runtime, a.GetSessionId(), docker.ContainerRequest{
 		Image:        config.ComposeConfig.Image.Agent,
 		Name:         containerName,
 		ExposedPorts: []string{common.ServerAgentPort, common.ServerAgentEventBusPort},
@@ -120,7 +123,7 @@ func (a *Agent) StartAgentForServer(ctx context.Context, autoStart bool, bootInD
 			common.TpcDebug:           os.Getenv(common.TpcDebug),
 			common.TpcName:            containerName,
 		},
-		Networks: []string{a.composeProvider.GetDockerProvider().GetDefaultNetwork(), a.composeProvider.GetConfig().Network},
+		Networks: sessionNetworks(runtime, a.composeProvider.GetConfig().Network),
 		NetworkAliases: map[string][]string{
 			a.composeProvider.GetConfig().Network: {"agent"},
 		},
@@ -129,76 +132,29 @@ func (a *Agent) StartAgentForServer(ctx context.Context, autoStart bool, bootInD
 			docker.AgentType: docker.AgentTypeServer,
 		},
 		AutoRemove: false,
-	}, a.composeProvider.GetSessionId())
+	}), a.composeProvider.GetSessionId())
 }
 
+// StartAgentForSetVolume fills the volumes from their path in the context, it runs in this process
+// through the archive api of the runtime instead of a volume agent container
 func (a *Agent) StartAgentForSetVolume(ctx context.Context) error {
-	agentMounts := make([]docker.ContainerMount, 0)
-	agentMounts = append(agentMounts, docker.BindMount("/var/run/docker.sock", "/var/run/docker.sock"))
-	agentMounts = append(agentMounts, docker.BindMount(a.composeProvider.GetContextPathForMount(), common.AgentContextPath))
-	agentMounts = append(agentMounts, docker.VolumeMount(common.SystemLogVolumeName+"_"+a.GetSessionId(), common.AgentLogPath))
-	cmd := make([]string, 0)
-	cmd = append(cmd, "prepareVolume", "--fromConfigJson", config.GetConfigJson())
-	for _, volume := range a.composeProvider.GetConfig().Volumes {
-		volumeId := volume.Name + "_" + a.composeProvider.GetSessionId()
-		agentMounts = append(agentMounts, docker.VolumeMount(volumeId, docker.ContainerMountTarget(common.AgentVolumePath+volume.Name)))
-	}
-	containerName := common.ContainerNamePrefix + "agent_volume_" + a.composeProvider.GetSessionId()
-	return a.runAndGetAgentError(ctx, docker.ContainerRequest{
-		Image: config.ComposeConfig.Image.Agent,
-		Name:  common.ContainerNamePrefix + "agent_volume_" + a.composeProvider.GetSessionId(),
-		Env: map[string]string{
-			common.LabelSessionID:     a.composeProvider.GetSessionId(),
-			common.EnvHostContextPath: a.composeProvider.GetContextPathForMount(),
-			common.TpcDebug:           os.Getenv(common.TpcDebug),
-			common.TpcName:            containerName,
-		},
-		Mounts: agentMounts,
-		Cmd:    cmd,
-		Labels: map[string]string{
-			docker.AgentType: docker.AgentTypeVolume,
-		},
-	}, true)
+	return a.seedVolumes(ctx, a.composeProvider.GetConfig().Volumes)
 }
+
+// StartAgentForSetVolumeGroup fills the volumes of the group like StartAgentForSetVolume
 func (a *Agent) StartAgentForSetVolumeGroup(ctx context.Context, selectGroupIndex int) error {
-	agentMounts := make([]docker.ContainerMount, 0)
-	agentMounts = append(agentMounts, docker.BindMount("/var/run/docker.sock", "/var/run/docker.sock"))
-	agentMounts = append(agentMounts, docker.BindMount(a.composeProvider.GetContextPathForMount(), common.AgentContextPath))
-	agentMounts = append(agentMounts, docker.VolumeMount(common.SystemLogVolumeName+"_"+a.GetSessionId(), common.AgentLogPath))
-	cmd := make([]string, 0)
-	cmd = append(cmd, "prepareVolumeGroup")
-	cmd = append(cmd, "-s")
-	cmd = append(cmd, strconv.Itoa(selectGroupIndex))
-	cmd = append(cmd, "--fromConfigJson")
-	cmd = append(cmd, config.GetConfigJson())
-	for _, volume := range a.composeProvider.GetConfig().VolumeGroups[selectGroupIndex].Volumes {
-		volumeId := volume.Name + "_" + a.composeProvider.GetSessionId()
-		agentMounts = append(agentMounts, docker.VolumeMount(volumeId, docker.ContainerMountTarget(common.AgentVolumePath+volume.Name)))
-	}
-	containerName := common.ContainerNamePrefix + "agent_volume_" + a.composeProvider.GetSessionId()
-	return a.runAndGetAgentError(ctx, docker.ContainerRequest{
-		Image: config.ComposeConfig.Image.Agent,
-		Name:  containerName,
-		Env: map[string]string{
-			common.LabelSessionID:     a.composeProvider.GetSessionId(),
-			common.EnvHostContextPath: a.composeProvider.GetContextPathForMount(),
-			common.TpcDebug:           os.Getenv(common.TpcDebug),
-			common.TpcName:            containerName,
-		},
-		Mounts: agentMounts,
-		Cmd:    cmd,
-		Labels: map[string]string{
-			docker.AgentType: docker.AgentTypeVolume,
-		},
-	}, true)
+	return a.seedVolumes(ctx, a.composeProvider.GetConfig().VolumeGroups[selectGroupIndex].Volumes)
 }
 
 func (a *Agent) StartAgentForClean(ctx context.Context) error {
+	if a.composeProvider.InProcess() {
+		a.composeProvider.GetRuntime().ClearWithSession(ctx, a.GetSessionId())
+		return nil
+	}
 	containerName := common.ContainerNamePrefix + "agent_clean_" + a.composeProvider.GetSessionId()
 	return a.runAndGetAgentError(ctx, docker.ContainerRequest{
-		Image:  config.ComposeConfig.Image.Agent,
-		Mounts: docker.Mounts(docker.BindMount("/var/run/docker.sock", "/var/run/docker.sock")),
-		Name:   containerName,
+		Image: config.ComposeConfig.Image.Agent,
+		Name:  containerName,
 		Env: map[string]string{
 			common.LabelSessionID: a.composeProvider.GetSessionId(),
 			common.TpcDebug:       os.Getenv(common.TpcDebug),
@@ -214,8 +170,7 @@ func (a *Agent) StartAgentForClean(ctx context.Context) error {
 
 func (a *Agent) StartAgentForSwitchData(ctx context.Context, selectGroupIndex int) error {
 	agentMounts := make([]docker.ContainerMount, 0)
-	agentMounts = append(agentMounts, docker.BindMount("/var/run/docker.sock", "/var/run/docker.sock"))
-	agentMounts = append(agentMounts, docker.BindMount(a.composeProvider.GetContextPathForMount(), common.AgentContextPath))
+	agentMounts = append(agentMounts, contextMount(a.composeProvider.GetRuntime(), a.GetSessionId(), a.composeProvider.GetContextPathForMount()))
 	agentMounts = append(agentMounts, docker.VolumeMount(common.SystemLogVolumeName+"_"+a.GetSessionId(), common.AgentLogPath))
 	cmd := make([]string, 0)
 	cmd = append(cmd, "switch")
@@ -241,8 +196,10 @@ func (a *Agent) StartAgentForSwitchData(ctx context.Context, selectGroupIndex in
 	}, true)
 }
 func (a *Agent) startAgentForIngressSetVolume(ctx context.Context, volumeId string, servicePortInfo map[string]string) error {
+	if a.composeProvider.InProcess() {
+		return a.seedIngressVolume(ctx, volumeId, servicePortInfo)
+	}
 	agentMounts := make([]docker.ContainerMount, 0)
-	agentMounts = append(agentMounts, docker.BindMount("/var/run/docker.sock", "/var/run/docker.sock"))
 	agentMounts = append(agentMounts, docker.VolumeMount(volumeId, docker.ContainerMountTarget(filepath.Join(common.AgentVolumePath, common.IngressVolumeName))))
 	agentMounts = append(agentMounts, docker.VolumeMount(common.SystemLogVolumeName+"_"+a.GetSessionId(), common.AgentLogPath))
 	cmd := make([]string, 0)
@@ -272,45 +229,37 @@ func (a *Agent) startAgentForIngressSetVolume(ctx context.Context, volumeId stri
 }
 
 func (a *Agent) StartAgentForIngress(ctx context.Context, servicePortInfo map[string]string) (docker.Container, error) {
-	for serviceName, port := range servicePortInfo {
-		portPair := strings.Split(port, ":")
-		exposePort, _ := strconv.ParseInt(portPair[1], 10, 64)
-		if exposePort <= 0 {
-			delete(a.servicePortInfoMap, serviceName)
-		} else {
-			a.servicePortInfoMap[serviceName] = port
-		}
-	}
+	servicePortInfoMap := a.updateServicePorts(servicePortInfo)
 	volumeName := common.IngressVolumeName
 	volumeId := volumeName + "_" + a.GetSessionId()
 	containerName := common.ContainerNamePrefix + "agent_ingress_" + a.composeProvider.GetSessionId()
 	// first remove ingress container
-	ingressContainer, _ := a.composeProvider.GetDockerProvider().FindContainerByName(ctx, containerName)
+	ingressContainer, _ := a.composeProvider.GetRuntime().FindContainerByName(ctx, containerName)
 	if ingressContainer != nil {
-		_ = a.composeProvider.GetDockerProvider().RemoveContainer(ctx, ingressContainer.ID)
+		_ = a.composeProvider.GetRuntime().RemoveContainer(ctx, ingressContainer.ID)
 	}
 	// then remove ingress volume
-	_ = a.composeProvider.GetDockerProvider().RemoveVolume(ctx, volumeName, a.GetSessionId(), true)
-	if len(a.servicePortInfoMap) == 0 {
+	_ = a.composeProvider.GetRuntime().RemoveVolume(ctx, volumeName, a.GetSessionId(), true)
+	if len(servicePortInfoMap) == 0 {
 		return nil, nil
 	}
 	// create ingress volume
-	_, err := a.composeProvider.GetDockerProvider().CreateVolume(ctx, volumeName, a.GetSessionId(), "")
+	_, err := a.composeProvider.GetRuntime().CreateVolume(ctx, volumeName, a.GetSessionId(), "")
 	if err != nil {
 		return nil, err
 	}
 	// prepare volume
-	err = a.startAgentForIngressSetVolume(ctx, volumeId, a.servicePortInfoMap)
+	err = a.startAgentForIngressSetVolume(ctx, volumeId, servicePortInfoMap)
 	if err != nil {
 		return nil, err
 	}
 	// start ingress container
 	exposePorts := make([]string, 0)
-	for _, portInfo := range a.servicePortInfoMap {
+	for _, portInfo := range servicePortInfoMap {
 		ports := strings.SplitN(portInfo, ":", 2)
 		exposePorts = append(exposePorts, ports[1]+":"+ports[1])
 	}
-	container, err := a.composeProvider.GetDockerProvider().RunContainer(ctx, docker.ContainerRequest{
+	container, err := a.composeProvider.GetRuntime().RunContainer(ctx, docker.ContainerRequest{
 		Image:  config.ComposeConfig.Image.Ingress,
 		Name:   containerName,
 		Mounts: docker.Mounts(docker.VolumeMount(volumeId, "/etc/envoy")),
@@ -327,7 +276,7 @@ func (a *Agent) StartAgentForIngress(ctx context.Context, servicePortInfo map[st
 	if err != nil {
 		return nil, err
 	}
-	event.Publish(&event.IngressEventData{
+	event.Publish(ctx, &event.IngressEventData{
 		Type:         event.IngressEventChange,
 		IngressInfos: a.getIngressInfos(),
 	})
@@ -338,7 +287,8 @@ func (a *Agent) StartAgentForIngress(ctx context.Context, servicePortInfo map[st
 // must use waitingFor exit
 func (a *Agent) runAndGetAgentError(ctx context.Context, containerRequest docker.ContainerRequest, remove bool) error {
 	containerRequest.WaitingFor = wait.ForExit()
-	container, err := a.composeProvider.GetDockerProvider().CreateContainerAutoLabel(ctx, containerRequest, a.composeProvider.GetSessionId())
+	containerRequest = withRuntime(a.composeProvider.GetRuntime(), a.GetSessionId(), containerRequest)
+	container, err := a.composeProvider.GetRuntime().CreateContainerAutoLabel(ctx, containerRequest, a.composeProvider.GetSessionId())
 	if err != nil {
 		return err
 	}
@@ -350,7 +300,7 @@ func (a *Agent) runAndGetAgentError(ctx context.Context, containerRequest docker
 		return nil
 	}
 	if remove {
-		defer a.composeProvider.GetDockerProvider().RemoveContainer(ctx, container.GetContainerID())
+		defer a.composeProvider.GetRuntime().RemoveContainer(ctx, container.GetContainerID())
 	}
 	state, err := container.State(ctx)
 	if err != nil {
@@ -361,3 +311,23 @@ func (a *Agent) runAndGetAgentError(ctx context.Context, containerRequest docker
 	}
 	return nil
 }
+
+// updateServicePorts applies the requested ports, a host port 0 removes the service, and returns a copy of the result
+func (a *Agent) updateServicePorts(servicePortInfo map[string]string) map[string]string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for serviceName, port := range servicePortInfo {
+		portPair := strings.Split(port, ":")
+		exposePort, _ := strconv.ParseInt(portPair[1], 10, 64)
+		if exposePort <= 0 {
+			delete(a.servicePortInfoMap, serviceName)
+		} else {
+			a.servicePortInfoMap[serviceName] = port
+		}
+	}
+	servicePortInfoMap := make(map[string]string, len(a.servicePortInfoMap))
+	for serviceName, port := range a.servicePortInfoMap {
+		servicePortInfoMap[serviceName] = port
+	}
+	return servicePortInfoMap
+}
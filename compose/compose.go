@@ -7,10 +7,13 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"gopkg.in/yaml.v2"
+	"os"
 	"path/filepath"
 	"podcompose/common"
 	"podcompose/docker"
 	"podcompose/event"
+	"podcompose/metrics"
+	"podcompose/trace"
 	"strconv"
 	"sync"
 )
@@ -18,41 +21,71 @@ import (
 type Compose struct {
 	podCompose      *PodCompose
 	config          *ComposeConfig
-	dockerProvider  *docker.DockerProvider
+	dockerProvider  docker.Runtime
 	volume          *VolumeGroups
+	stats           *Stats
+	eventSinks      *EventSinks
 	contextPath     string
 	hostContextPath string
+	session         *SessionLock
+	inProcess       bool
+	readyLock       sync.RWMutex
 	ready           bool
 	triggerLock     sync.Mutex
 }
 
 func NewCompose(configBytes []byte, sessionId string, contextPath string, hostContextPath string) (*Compose, error) {
-	contextPath, err := filepath.Abs(contextPath)
+	config, contextPath, err := loadConfig(configBytes, sessionId, contextPath)
 	if err != nil {
 		return nil, err
 	}
+	provider, err := docker.NewDockerProvider()
+	if err != nil {
+		return nil, err
+	}
+	return newCompose(config, sessionId, contextPath, hostContextPath, provider)
+}
+
+// NewComposeWithRuntime creates the compose on the given runtime, e.g. an in-memory fake in tests
+func NewComposeWithRuntime(configBytes []byte, sessionId string, contextPath string, hostContextPath string, provider docker.Runtime) (*Compose, error) {
+	config, contextPath, err := loadConfig(configBytes, sessionId, contextPath)
+	if err != nil {
+		return nil, err
+	}
+	return newCompose(config, sessionId, contextPath, hostContextPath, provider)
+}
+
+// loadConfig parses and checks the config, the absolute context path is returned with it
+func loadConfig(configBytes []byte, sessionId string, contextPath string) (*ComposeConfig, string, error) {
+	contextPath, err := filepath.Abs(contextPath)
+	if err != nil {
+		return nil, "", err
+	}
 	var config ComposeConfig
 	err = yaml.Unmarshal(configBytes, &config)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	config.SessionId = sessionId
 	if config.SessionId == "" {
 		config.SessionId = genSessionId()
 	}
 	config.Network = "PodTestComposeNetwork_" + config.SessionId
+	trace.DefaultRecorder.SetResourceAttribute("session.id", config.SessionId)
 	err = config.check(contextPath)
 	if err != nil {
-		return nil, err
-	}
-	provider, err := docker.NewDockerProvider()
-	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	return &config, contextPath, nil
+}
+
+func newCompose(config *ComposeConfig, sessionId string, contextPath string, hostContextPath string, provider docker.Runtime) (*Compose, error) {
 	compose, err := NewPodCompose(sessionId, hostContextPath, config.Pods, config.Network, provider)
 	if err != nil {
 		return nil, err
 	}
+	volumes := NewVolumeGroups(config.VolumeGroups, provider)
+	compose.volumes = volumes
 	taskGroupEventRunRecord := make(map[string]bool)
 	for _, taskGroup := range config.TaskGroups {
 		if taskGroup.Event != "" {
@@ -61,11 +94,14 @@ func NewCompose(configBytes []byte, sessionId string, contextPath string, hostCo
 	}
 	return &Compose{
 		podCompose:      compose,
-		config:          &config,
+		config:          config,
 		dockerProvider:  provider,
-		volume:          NewVolumeGroups(config.VolumeGroups, provider),
+		volume:          volumes,
+		stats:           NewStats(provider, config.SessionId),
+		eventSinks:      NewEventSinks(config.EventSinks),
 		contextPath:     contextPath,
 		hostContextPath: hostContextPath,
+		session:         NewSessionLock(),
 	}, nil
 }
 
@@ -76,34 +112,71 @@ func genSessionId() string {
 }
 
 func (c *Compose) StartPods(ctx context.Context) error {
+	ctx, span := trace.Start(ctx, "start_pods")
 	eventData := event.ComposeEventData{
 		Type:    event.ComposeEventBeforeStartType,
 		Trigger: c.SystemAutoTaskGroup,
 	}
-	event.Publish(&eventData)
+	event.Publish(ctx, &eventData)
 	zap.L().Info("Compose start running")
+	c.stats.Start()
 	err := c.podCompose.start(ctx)
+	span.Finish(err)
+	c.WriteTrace()
 	if err != nil {
 		eventData = event.ComposeEventData{
 			Type:    event.ComposeEventStartFailType,
 			Trigger: c.SystemAutoTaskGroup,
 		}
 	} else {
-		c.ready = true
+		c.setReady(true)
 		zap.L().Info("Compose is ready, all pods is started")
 		eventData = event.ComposeEventData{
 			Type:    event.ComposeEventStartSuccessType,
 			Trigger: c.SystemAutoTaskGroup,
 		}
 	}
-	event.Publish(&eventData)
-	event.Publish(&event.ComposeEventData{
+	event.Publish(ctx, &eventData)
+	event.Publish(ctx, &event.ComposeEventData{
 		Type:    event.ComposeEventStartFinishType,
 		Trigger: c.SystemAutoTaskGroup,
 	})
 	return err
 }
 
+// Start creates the volumes and the default volume group, fills them through the agent and starts the pods
+func (c *Compose) Start(ctx context.Context, agent *Agent) error {
+	volumeCtx, volumeSpan := trace.Start(ctx, "prepare_volumes")
+	err := c.CreateVolumes(volumeCtx, c.GetConfig().Volumes)
+	if err == nil {
+		err = agent.StartAgentForSetVolume(volumeCtx)
+	}
+	volumeSpan.Finish(err)
+	if err != nil {
+		return err
+	}
+	// create volume group default
+	if len(c.GetConfig().VolumeGroups) > 0 {
+		defaultGroup := c.GetConfig().VolumeGroups[0]
+		volumeGroupCtx, volumeGroupSpan := trace.Start(ctx, "prepare_volume_group")
+		volumeGroupSpan.SetAttribute("volume_group.name", defaultGroup.Name)
+		err := c.CreateVolumesWithGroup(volumeGroupCtx, defaultGroup)
+		if err == nil {
+			err = agent.StartAgentForSetVolumeGroup(volumeGroupCtx, 0)
+		}
+		if err != nil {
+			for _, volume := range defaultGroup.Volumes {
+				c.volume.deactivate(volume.Name)
+			}
+		}
+		volumeGroupSpan.Finish(err)
+		if err != nil {
+			return err
+		}
+	}
+	return c.StartPods(ctx)
+}
+
 func (c *Compose) CreateVolumesWithGroup(ctx context.Context, defaultGroup *VolumeGroupConfig) error {
 	return c.volume.createVolumesWithGroup(ctx, c.GetConfig().SessionId, defaultGroup)
 }
@@ -113,8 +186,50 @@ func (c *Compose) CreateVolumes(ctx context.Context, volumes []*VolumeConfig) er
 func (c *Compose) CreateSystemLogVolume(ctx context.Context) (types.Volume, error) {
 	return c.volume.createVolume(ctx, c.GetConfig().SessionId, common.SystemLogVolumeName)
 }
-func (c *Compose) RecreateVolumesWithGroup(ctx context.Context, volumeGroup *VolumeGroupConfig) error {
-	return c.volume.recreateVolumesWithGroup(ctx, volumeGroup, c.GetConfig().SessionId)
+
+// ShipContext copies the context directory and the tls material of DOCKER_CERT_PATH into volumes of the session
+// when the engine is on another machine, the agents mount them instead of the paths of this machine
+func (c *Compose) ShipContext(ctx context.Context) error {
+	if !c.dockerProvider.Capabilities().Remote {
+		return nil
+	}
+	if err := c.shipDir(ctx, common.ContextVolumeName, c.contextPath); err != nil {
+		return errors.Wrap(err, "ship context")
+	}
+	if certPath := os.Getenv(docker.CertPathEnv); certPath != "" {
+		return errors.Wrap(c.shipDir(ctx, common.CertVolumeName, certPath), "ship tls material")
+	}
+	return nil
+}
+
+func (c *Compose) shipDir(ctx context.Context, volumeName string, dir string) error {
+	if _, err := c.volume.createVolume(ctx, c.GetSessionId(), volumeName); err != nil {
+		return err
+	}
+	archive := docker.ArchiveDir(dir)
+	defer archive.Close()
+	return c.dockerProvider.CopyToVolume(ctx, volumeName, c.GetSessionId(), archive)
+}
+
+// SetVolumeSource makes the containers mount the volume source instead of the session volume of the name
+func (c *Compose) SetVolumeSource(name string, source string) {
+	c.volume.setSource(name, source)
+}
+
+// GetVolumeSources are the volumes the containers mount instead of the session volume by volume name,
+// e.g. the cache volume of a read only cached volume
+func (c *Compose) GetVolumeSources() map[string]string {
+	return c.volume.sources(c.GetSessionId())
+}
+
+// GetVolumeInfos are the volumes of the volume groups with the group each one holds
+func (c *Compose) GetVolumeInfos() []common.VolumeInfo {
+	return c.volume.volumeInfos(c.GetSessionId())
+}
+
+// RecreateVolumesWithGroup recreates the volumes of the group empty
+func (c *Compose) RecreateVolumesWithGroup(ctx context.Context, volumeGroup *VolumeGroupConfig, volumes []*VolumeConfig) error {
+	return c.volume.recreateVolumesWithGroup(ctx, volumeGroup, volumes, c.GetConfig().SessionId)
 }
 
 func (c *Compose) FindPodsWhoUsedVolumes(volumeNames []string) []*PodConfig {
@@ -122,7 +237,7 @@ func (c *Compose) FindPodsWhoUsedVolumes(volumeNames []string) []*PodConfig {
 }
 
 func (c *Compose) RestartPods(ctx context.Context, podNames []string, beforeStart func() error) error {
-	if !c.ready {
+	if !c.IsReady() {
 		return errors.New("compose is not ready, can not restart")
 	}
 	for _, podName := range podNames {
@@ -134,12 +249,15 @@ func (c *Compose) RestartPods(ctx context.Context, podNames []string, beforeStar
 		Type:    event.ComposeEventBeforeRestartType,
 		Trigger: c.SystemAutoTaskGroup,
 	}
-	event.Publish(&eventData)
+	event.Publish(ctx, &eventData)
 	zap.L().Info("Compose restart pods")
-	c.ready = false
+	c.setReady(false)
+	ctx, span := trace.Start(ctx, "restart_pods")
 	err := c.podCompose.RestartPods(ctx, podNames, beforeStart)
+	span.Finish(err)
+	c.WriteTrace()
 	if err == nil {
-		c.ready = true
+		c.setReady(true)
 		eventData = event.ComposeEventData{
 			Type:    event.ComposeEventRestartSuccessType,
 			Trigger: c.SystemAutoTaskGroup,
@@ -151,18 +269,133 @@ func (c *Compose) RestartPods(ctx context.Context, podNames []string, beforeStar
 			Trigger: c.SystemAutoTaskGroup,
 		}
 	}
-	event.Publish(&eventData)
-	event.Publish(&event.ComposeEventData{
+	event.Publish(ctx, &eventData)
+	event.Publish(ctx, &event.ComposeEventData{
 		Type:    event.ComposeEventRestartFinishType,
 		Trigger: c.SystemAutoTaskGroup,
 	})
 	return err
 }
 
+// SwitchVolumeGroup restarts the pods using the volumes whose source differs from the active group, those volumes
+// are recreated and filled with the data of the group while the pods are removed, the others are kept
+func (c *Compose) SwitchVolumeGroup(ctx context.Context, agent *Agent, name string) error {
+	selectVolumeGroup, _ := c.config.VolumeGroups.GetGroup(name)
+	if selectVolumeGroup == nil {
+		return errors.Errorf("not found volume group %s", name)
+	}
+	changed := c.volume.changedVolumes(selectVolumeGroup)
+	if len(changed) == 0 {
+		zap.L().Sugar().Infof("volume group %s has the sources of the active volumes, nothing to switch", name)
+		c.volume.activate(selectVolumeGroup)
+		return nil
+	}
+	volumeNames := make([]string, 0)
+	for _, volume := range changed {
+		volumeNames = append(volumeNames, volume.Name)
+	}
+	pods := c.FindPodsWhoUsedVolumes(volumeNames)
+	podNames := make([]string, len(pods))
+	for k, v := range pods {
+		podNames[k] = v.Name
+	}
+	return c.RestartPods(ctx, podNames, func() error {
+		err := c.RecreateVolumesWithGroup(ctx, selectVolumeGroup, changed)
+		if err != nil {
+			return err
+		}
+		if err = agent.seedVolumes(ctx, changed); err != nil {
+			return err
+		}
+		c.volume.activate(selectVolumeGroup)
+		return nil
+	})
+}
+
+func (c *Compose) GetStats() []common.PodStats {
+	return c.stats.GetPodStats()
+}
+
+// StopStats stops collecting the stats and saves the peak usage per pod to the log volume
+func (c *Compose) StopStats() error {
+	return c.stats.Finish(c.logPath())
+}
+
+// StartEventSinks posts the events of the bus to the webhooks of the config
+func (c *Compose) StartEventSinks(bus *event.EventBus) {
+	c.eventSinks.Start(bus)
+}
+
+// StopEventSinks delivers the queued events and stops the webhooks
+func (c *Compose) StopEventSinks() {
+	c.eventSinks.Stop()
+}
+
+// WriteTrace exports the recorded spans into the log volume, there is none in process
+func (c *Compose) WriteTrace() {
+	logPath := c.logPath()
+	if logPath == "" {
+		return
+	}
+	if err := trace.DefaultRecorder.WriteFiles(logPath); err != nil {
+		zap.L().Sugar().Debugf("write trace error: %s", err)
+	}
+}
+
 func (c *Compose) IsReady() bool {
+	c.readyLock.RLock()
+	defer c.readyLock.RUnlock()
 	return c.ready
 }
 
+func (c *Compose) setReady(ready bool) {
+	c.readyLock.Lock()
+	defer c.readyLock.Unlock()
+	c.ready = ready
+}
+
+// SetInProcess makes the agent seed the volumes and clean the session from this process
+// instead of running agent containers, it is set before the compose starts
+func (c *Compose) SetInProcess(inProcess bool) {
+	c.inProcess = inProcess
+}
+
+func (c *Compose) InProcess() bool {
+	return c.inProcess
+}
+
+// logPath is where the log volume is mounted in the agent, empty in process where the host has no log volume
+func (c *Compose) logPath() string {
+	if c.inProcess {
+		return ""
+	}
+	return common.AgentLogPath
+}
+
+// Session is the lock the mutating operations of the session take, see SessionLock
+func (c *Compose) Session() *SessionLock {
+	return c.session
+}
+
+// AutoStart runs start as a start operation of its own holding the session lock, like the start api does
+// when the agent boots with autoStart
+func (c *Compose) AutoStart(start func(ctx context.Context) error) error {
+	ctx := event.WithOperationId(context.Background(), event.NewOperationId())
+	release, err := c.session.Acquire(ctx, SessionHolder{
+		OperationId: event.OperationId(ctx),
+		Name:        "start",
+	})
+	if err != nil {
+		return err
+	}
+	defer release()
+	return start(ctx)
+}
+
+func (c *Compose) GetContextPath() string {
+	return c.contextPath
+}
+
 func (c *Compose) GetContextPathForMount() string {
 	if c.hostContextPath != "" {
 		return c.hostContextPath
@@ -179,7 +412,7 @@ func (c *Compose) GetSessionId() string {
 	return c.config.SessionId
 }
 
-func (c *Compose) GetDockerProvider() *docker.DockerProvider {
+func (c *Compose) GetRuntime() docker.Runtime {
 	return c.dockerProvider
 }
 
@@ -208,15 +441,17 @@ func (c *Compose) SystemAutoTaskGroup(ctx context.Context, eventName string) err
 	for _, taskGroup := range taskGroups {
 		taskGroup := taskGroup
 		go func() {
+			// every auto triggered task group is an operation of its own
+			ctx := event.WithOperationId(ctx, event.NewOperationId())
 			err := c.podCompose.StartTaskGroup("system_trigger_"+taskGroup.Name, taskGroup, ctx)
 			if err != nil {
 				zap.L().Sugar().Error("SystemAutoTaskGroup Error: ", err)
-				event.Publish(&event.ErrorData{
+				event.Publish(ctx, &event.ErrorData{
 					Reason:  "SystemAutoTaskGroup Error",
 					Message: err.Error(),
 				})
 			} else {
-				event.Publish(&event.ComposeEventData{
+				event.Publish(ctx, &event.ComposeEventData{
 					Type:    event.ComposeEventTaskGroupSuccess + ":" + taskGroup.Name,
 					Trigger: c.SystemAutoTaskGroup,
 				})
@@ -229,7 +464,7 @@ func (c *Compose) SystemAutoTaskGroup(ctx context.Context, eventName string) err
 }
 
 func (c *Compose) StartUserTaskGroup(ctx context.Context, name string) error {
-	if !c.ready {
+	if !c.IsReady() {
 		return errors.Errorf("compose is not ready, can not trigger task")
 	}
 	taskGroup := c.config.TaskGroups.GetTaskGroupFromName(name)
@@ -244,17 +479,22 @@ func (c *Compose) StartUserTaskGroup(ctx context.Context, name string) error {
 		Type:    event.ComposeEventTaskGroupSuccess + ":" + name,
 		Trigger: c.SystemAutoTaskGroup,
 	}
-	event.Publish(&eventData)
+	event.Publish(ctx, &eventData)
 	return err
 }
 
 func (c *Compose) StopPods(ctx context.Context) {
-	c.ready = false
+	c.setReady(false)
 	eventData := event.ComposeEventData{
 		Type:    event.ComposeEventBeforeStopType,
 		Trigger: c.SystemAutoTaskGroup,
 	}
-	event.Publish(&eventData)
+	event.Publish(ctx, &eventData)
+	c.podCompose.stop()
+	metrics.PodReady.Reset()
+	if err := c.StopStats(); err != nil {
+		zap.L().Sugar().Errorf("write stats summary error: %s", err)
+	}
 	cs, err := c.dockerProvider.FindAllContainersWithSessionId(ctx, c.GetSessionId())
 	if err != nil {
 		return
@@ -276,5 +516,5 @@ func (c *Compose) StopPods(ctx context.Context) {
 		Type:    event.ComposeEventAfterStopType,
 		Trigger: c.SystemAutoTaskGroup,
 	}
-	event.Publish(&eventData)
+	event.Publish(ctx, &eventData)
 }
@@ -1,9 +1,18 @@
 package compose
 
 import (
+	"archive/zip"
 	"context"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/smartystreets/goconvey/convey"
 	"os"
+	"path/filepath"
+	"podcompose/common"
+	"podcompose/docker"
+	"podcompose/docker/fake"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -27,3 +36,592 @@ func Test_Compose(t *testing.T) {
 		panic(err)
 	}
 }
+
+const fakeComposeConfig = `
+version: 1
+volumeGroups:
+  - name: empty
+    volumes:
+      - name: data
+  - name: seeded
+    volumes:
+      - name: data
+        path: testdata/seed
+pods:
+  - name: db
+    containers:
+      - name: db
+        image: mysql
+        volumeMounts:
+          - name: data
+            mountPath: /var/lib/mysql
+  - name: web
+    depends:
+      - db
+    containers:
+      - name: web
+        image: nginx
+  - name: cache
+    containers:
+      - name: cache
+        image: redis
+`
+
+func newFakeCompose(runtime *fake.Runtime) (*Compose, error) {
+	c, err := NewComposeWithRuntime([]byte(fakeComposeConfig), "s1", "", "", runtime)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if err = c.PrepareNetwork(ctx); err != nil {
+		return nil, err
+	}
+	if err = c.CreateVolumesWithGroup(ctx, c.GetConfig().VolumeGroups[0]); err != nil {
+		return nil, err
+	}
+	return c, c.StartPods(ctx)
+}
+
+func Test_ComposeSwitchVolumeGroup(t *testing.T) {
+	convey.Convey("test switch volume group with a fake runtime", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		c, err := newFakeCompose(runtime)
+		convey.So(err, convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		convey.So(c.IsReady(), convey.ShouldBeTrue)
+		before := containerIds(runtime, "s1")
+
+		err = c.SwitchVolumeGroup(ctx, NewAgent(c), "seeded")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(c.IsReady(), convey.ShouldBeTrue)
+		volume, ok := runtime.Volume("data_s1")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(volume.Labels[docker.VolumeGroup], convey.ShouldEqual, "seeded")
+		convey.So(string(runtime.VolumeFiles("data_s1")["init.sql"]), convey.ShouldEqual, "select 1;\n")
+		after := containerIds(runtime, "s1")
+		convey.So(after["tpc_db_db_s1"], convey.ShouldNotEqual, before["tpc_db_db_s1"])
+		convey.So(after["tpc_web_web_s1"], convey.ShouldNotEqual, before["tpc_web_web_s1"])
+		convey.So(after["tpc_cache_cache_s1"], convey.ShouldEqual, before["tpc_cache_cache_s1"])
+
+		err = c.SwitchVolumeGroup(ctx, NewAgent(c), "missing")
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+	convey.Convey("test switch only recreates the volumes whose source changed", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		c, err := NewComposeWithRuntime([]byte(incrementalSwitchConfig), "s1", "", "", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(c.PrepareNetwork(ctx), convey.ShouldBeNil)
+		convey.So(c.CreateVolumesWithGroup(ctx, c.GetConfig().VolumeGroups[0]), convey.ShouldBeNil)
+		convey.So(c.StartPods(ctx), convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		agent := NewAgent(c)
+		convey.So(agent.GetInfo().VolumeInfos, convey.ShouldResemble, []common.VolumeInfo{
+			{Name: "data", VolumeId: "data_s1", VolumeGroup: "small"},
+			{Name: "assets", VolumeId: "assets_s1", VolumeGroup: "small"},
+		})
+		before := containerIds(runtime, "s1")
+
+		convey.So(c.SwitchVolumeGroup(ctx, agent, "large"), convey.ShouldBeNil)
+		after := containerIds(runtime, "s1")
+		convey.So(after["tpc_db_db_s1"], convey.ShouldNotEqual, before["tpc_db_db_s1"])
+		convey.So(after["tpc_web_web_s1"], convey.ShouldEqual, before["tpc_web_web_s1"])
+		convey.So(string(runtime.VolumeFiles("data_s1")["init.sql"]), convey.ShouldEqual, "select 1;\n")
+		assets, _ := runtime.Volume("assets_s1")
+		convey.So(assets.Labels[docker.VolumeGroup], convey.ShouldEqual, "small")
+		convey.So(agent.GetInfo().VolumeInfos[0].VolumeGroup, convey.ShouldEqual, "large")
+		convey.So(agent.GetInfo().VolumeInfos[1].VolumeGroup, convey.ShouldEqual, "large")
+
+		convey.So(c.SwitchVolumeGroup(ctx, agent, "large"), convey.ShouldBeNil)
+		convey.So(containerIds(runtime, "s1"), convey.ShouldResemble, after)
+	})
+	convey.Convey("test a failed volume seed leaves the compose not ready", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		c, err := newFakeCompose(runtime)
+		convey.So(err, convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		runtime.OnCopy = func(volumeName string) error {
+			return errors.New("no space left on device")
+		}
+		err = c.SwitchVolumeGroup(ctx, NewAgent(c), "seeded")
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(c.IsReady(), convey.ShouldBeFalse)
+	})
+}
+
+const incrementalSwitchConfig = `
+version: 1
+volumeGroups:
+  - name: small
+    volumes:
+      - name: data
+      - name: assets
+  - name: large
+    volumes:
+      - name: data
+        path: testdata/seed
+      - name: assets
+pods:
+  - name: db
+    containers:
+      - name: db
+        image: mysql
+        volumeMounts:
+          - name: data
+            mountPath: /var/lib/mysql
+  - name: web
+    containers:
+      - name: web
+        image: nginx
+        volumeMounts:
+          - name: assets
+            mountPath: /usr/share/nginx/html
+`
+
+func Test_AgentIngress(t *testing.T) {
+	convey.Convey("test expose and remove ingress with a fake runtime", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		c, err := newFakeCompose(runtime)
+		convey.So(err, convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		agent := NewAgent(c)
+		ingressName := common.ContainerNamePrefix + "agent_ingress_s1"
+
+		_, err = agent.StartAgentForIngress(ctx, common.IngressRequest{"web": "80:8080"})
+		convey.So(err, convey.ShouldBeNil)
+		_, err = runtime.FindContainerByName(ctx, ingressName)
+		convey.So(err, convey.ShouldBeNil)
+		ingresses := agent.GetInfo().Ingresses
+		convey.So(ingresses, convey.ShouldHaveLength, 1)
+		convey.So(ingresses[0].HostPort, convey.ShouldEqual, "8080")
+
+		_, err = agent.StartAgentForIngress(ctx, common.IngressRequest{"web": "0:0"})
+		convey.So(err, convey.ShouldBeNil)
+		_, err = runtime.FindContainerByName(ctx, ingressName)
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(agent.GetInfo().Ingresses, convey.ShouldBeEmpty)
+	})
+}
+
+func Test_PodmanRuntime(t *testing.T) {
+	convey.Convey("test pause networks and the agent socket on podman", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		runtime.Engine = docker.EnginePodman
+		var lock sync.Mutex
+		requests := make(map[string]docker.ContainerRequest)
+		runtime.OnStart = func(req docker.ContainerRequest) error {
+			lock.Lock()
+			defer lock.Unlock()
+			requests[req.Name] = req
+			return nil
+		}
+		c, err := newFakeCompose(runtime)
+		convey.So(err, convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		_, err = NewAgent(c).StartAgentForIngress(ctx, common.IngressRequest{"web": "80:8080"})
+		convey.So(err, convey.ShouldBeNil)
+
+		lock.Lock()
+		defer lock.Unlock()
+		pause := requests[common.ContainerNamePrefix+"web_pause_s1"]
+		convey.So(pause.Networks, convey.ShouldResemble, []string{c.GetConfig().Network})
+		agent := requests[common.ContainerNamePrefix+"agent_ingress_volumes1"]
+		convey.So(agent.Env[docker.Host], convey.ShouldEqual, "unix://"+docker.AgentSocketPath)
+		convey.So(agent.SecurityOpt, convey.ShouldContain, "label=disable")
+		var socket string
+		for _, m := range agent.Mounts {
+			if m.Target.Target() == docker.AgentSocketPath {
+				socket = m.Source.Source()
+			}
+		}
+		convey.So(socket, convey.ShouldEqual, docker.AgentSocketPath)
+	})
+}
+
+func Test_RemoteRuntime(t *testing.T) {
+	convey.Convey("test the context and tls material of a remote engine", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		runtime.Remote = true
+		var lock sync.Mutex
+		requests := make(map[string]docker.ContainerRequest)
+		runtime.OnStart = func(req docker.ContainerRequest) error {
+			lock.Lock()
+			defer lock.Unlock()
+			requests[req.Name] = req
+			return nil
+		}
+		contextPath := t.TempDir()
+		certPath := t.TempDir()
+		convey.So(os.WriteFile(filepath.Join(contextPath, common.ConfigFileName), []byte(fakeComposeConfig), 0644), convey.ShouldBeNil)
+		convey.So(os.MkdirAll(filepath.Join(contextPath, "testdata", "seed"), 0755), convey.ShouldBeNil)
+		convey.So(os.WriteFile(filepath.Join(certPath, "ca.pem"), []byte("ca"), 0644), convey.ShouldBeNil)
+		t.Setenv(docker.CertPathEnv, certPath)
+		t.Setenv(docker.TLSVerifyEnv, "1")
+		c, err := NewComposeWithRuntime([]byte(fakeComposeConfig), "s1", contextPath, "/not/on/the/engine", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(c.ShipContext(ctx), convey.ShouldBeNil)
+		convey.So(runtime.VolumeFiles(common.ContextVolumeName+"_s1"), convey.ShouldContainKey, common.ConfigFileName)
+		convey.So(runtime.VolumeFiles(common.CertVolumeName+"_s1"), convey.ShouldContainKey, "ca.pem")
+
+		_, err = NewAgent(c).StartAgentForServer(ctx, false, false)
+		convey.So(err, convey.ShouldBeNil)
+		lock.Lock()
+		defer lock.Unlock()
+		agent := requests[common.ContainerNamePrefix+"agent_s1"]
+		convey.So(agent.Env[docker.Host], convey.ShouldEqual, "tcp://fake:2376")
+		convey.So(agent.Env[docker.RemoteEnv], convey.ShouldEqual, "true")
+		convey.So(agent.Env[docker.CertPathEnv], convey.ShouldEqual, common.AgentCertPath)
+		sources := make(map[string]string)
+		for _, m := range agent.Mounts {
+			sources[m.Target.Target()] = m.Source.Source()
+		}
+		convey.So(sources[common.AgentContextPath], convey.ShouldEqual, common.ContextVolumeName+"_s1")
+		convey.So(sources[common.AgentCertPath], convey.ShouldEqual, common.CertVolumeName+"_s1")
+		convey.So(sources, convey.ShouldNotContainKey, docker.AgentSocketPath)
+	})
+}
+
+const cachedComposeConfig = `
+version: 1
+volumes:
+  - name: data
+    path: testdata/seed
+    cache: true
+  - name: fixtures
+    path: testdata/seed
+    cache: true
+    readOnly: true
+pods:
+  - name: db
+    containers:
+      - name: db
+        image: mysql
+        volumeMounts:
+          - name: data
+            mountPath: /var/lib/mysql
+          - name: fixtures
+            mountPath: /fixtures
+`
+
+func Test_CachedVolume(t *testing.T) {
+	convey.Convey("test sessions share the cache volume of the same content", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		var lock sync.Mutex
+		copies := make(map[string]int)
+		requests := make(map[string]docker.ContainerRequest)
+		runtime.OnCopy = func(volumeName string) error {
+			lock.Lock()
+			defer lock.Unlock()
+			copies[volumeName]++
+			return nil
+		}
+		runtime.OnStart = func(req docker.ContainerRequest) error {
+			lock.Lock()
+			defer lock.Unlock()
+			requests[req.Name] = req
+			return nil
+		}
+		for _, sessionId := range []string{"s1", "s2"} {
+			c, err := NewComposeWithRuntime([]byte(cachedComposeConfig), sessionId, "", "", runtime)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(c.PrepareNetwork(ctx), convey.ShouldBeNil)
+			convey.So(c.Start(ctx, NewAgent(c)), convey.ShouldBeNil)
+			defer c.StopPods(ctx)
+		}
+		caches, err := runtime.FindAllCacheVolumes(ctx)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(caches, convey.ShouldHaveLength, 1)
+		cache := caches[0]
+		convey.So(cache.Labels[docker.CacheSourceLabel], convey.ShouldEqual, "testdata/seed")
+		lock.Lock()
+		defer lock.Unlock()
+		convey.So(copies, convey.ShouldResemble, map[string]int{cache.Name: 1})
+
+		convey.So(string(runtime.VolumeFiles("data_s1")["init.sql"]), convey.ShouldEqual, "select 1;\n")
+		convey.So(string(runtime.VolumeFiles("data_s2")["init.sql"]), convey.ShouldEqual, "select 1;\n")
+		convey.So(runtime.VolumeFiles("fixtures_s2"), convey.ShouldBeEmpty)
+		mounts := make(map[string]docker.ContainerMount)
+		for _, m := range requests[common.ContainerNamePrefix+"db_db_s2"].Mounts {
+			mounts[m.Target.Target()] = m
+		}
+		convey.So(mounts["/var/lib/mysql"].Source.Source(), convey.ShouldEqual, "data_s2")
+		convey.So(mounts["/var/lib/mysql"].ReadOnly, convey.ShouldBeFalse)
+		convey.So(mounts["/fixtures"].Source.Source(), convey.ShouldEqual, cache.Name)
+		convey.So(mounts["/fixtures"].ReadOnly, convey.ShouldBeTrue)
+		convey.So(runtime.RemoveCacheVolume(ctx, cache.Name), convey.ShouldNotBeNil)
+	})
+	convey.Convey("test a cache being filled or failed is not reused", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		hash, err := docker.HashSource("testdata/seed", docker.ArchiveOptions{Owner: &docker.Owner{}})
+		convey.So(err, convey.ShouldBeNil)
+		filling := ""
+		runtime.OnCopy = func(volumeName string) error {
+			if strings.HasPrefix(volumeName, common.ContainerNamePrefix+"cache_") {
+				filling = volumeName
+				if cache, _ := runtime.FindCacheVolume(ctx, hash); cache != nil {
+					return errors.Errorf("found the cache %s being filled", cache.Name)
+				}
+				return errors.New("no space left on device")
+			}
+			return nil
+		}
+		c, err := NewComposeWithRuntime([]byte(cachedComposeConfig), "s1", "", "", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(c.PrepareNetwork(ctx), convey.ShouldBeNil)
+		err = c.Start(ctx, NewAgent(c))
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldContainSubstring, "no space left on device")
+		convey.So(filling, convey.ShouldEqual, docker.CacheVolumeName(hash, "s1"))
+		cache, err := runtime.FindCacheVolume(ctx, hash)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(cache, convey.ShouldBeNil)
+		caches, _ := runtime.FindAllCacheVolumes(ctx)
+		convey.So(caches, convey.ShouldBeEmpty)
+	})
+}
+
+const archiveComposeConfig = `
+version: 1
+volumeGroups:
+  - name: mixed
+    volumes:
+      - name: data
+        path: data
+      - name: fixtures
+        path: fixtures.zip
+pods:
+  - name: db
+    containers:
+      - name: db
+        image: mysql
+        volumeMounts:
+          - name: data
+            mountPath: /var/lib/mysql
+          - name: fixtures
+            mountPath: /fixtures
+`
+
+func Test_ArchiveVolumeSource(t *testing.T) {
+	convey.Convey("test a volume group mixing a directory and an archive", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		contextPath := t.TempDir()
+		convey.So(os.MkdirAll(filepath.Join(contextPath, "data"), 0755), convey.ShouldBeNil)
+		convey.So(os.WriteFile(filepath.Join(contextPath, "data", "init.sql"), []byte("select 1;\n"), 0644), convey.ShouldBeNil)
+		zipFile, err := os.Create(filepath.Join(contextPath, "fixtures.zip"))
+		convey.So(err, convey.ShouldBeNil)
+		zw := zip.NewWriter(zipFile)
+		w, err := zw.Create("users.csv")
+		convey.So(err, convey.ShouldBeNil)
+		_, _ = w.Write([]byte("id,name\n"))
+		convey.So(zw.Close(), convey.ShouldBeNil)
+		convey.So(zipFile.Close(), convey.ShouldBeNil)
+
+		c, err := NewComposeWithRuntime([]byte(archiveComposeConfig), "s1", contextPath, "", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(c.PrepareNetwork(ctx), convey.ShouldBeNil)
+		convey.So(c.Start(ctx, NewAgent(c)), convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		convey.So(string(runtime.VolumeFiles("data_s1")["init.sql"]), convey.ShouldEqual, "select 1;\n")
+		convey.So(string(runtime.VolumeFiles("fixtures_s1")["users.csv"]), convey.ShouldEqual, "id,name\n")
+
+		convey.So(os.WriteFile(filepath.Join(contextPath, "notes.txt"), []byte("notes"), 0644), convey.ShouldBeNil)
+		config := strings.Replace(archiveComposeConfig, "fixtures.zip", "notes.txt", 1)
+		_, err = NewComposeWithRuntime([]byte(config), "s2", contextPath, "", runtime)
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
+
+func Test_VolumeSnapshot(t *testing.T) {
+	convey.Convey("test restore a snapshot only restarts the pods using the volume", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		c, err := newFakeCompose(runtime)
+		convey.So(err, convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		convey.So(runtime.CopyToVolume(ctx, "data", "s1", docker.ArchiveFile("init.sql", []byte("select 1;"), 0644)), convey.ShouldBeNil)
+		convey.So(c.SnapshotVolume(ctx, "data", "clean"), convey.ShouldBeNil)
+		convey.So(runtime.CopyToVolume(ctx, "data", "s1", docker.ArchiveFile("dirty.sql", []byte("select 2;"), 0644)), convey.ShouldBeNil)
+		before := containerIds(runtime, "s1")
+
+		convey.So(c.RestoreVolume(ctx, "data", "clean"), convey.ShouldBeNil)
+		convey.So(c.IsReady(), convey.ShouldBeTrue)
+		convey.So(runtime.VolumeFiles("data_s1"), convey.ShouldResemble, map[string][]byte{"init.sql": []byte("select 1;")})
+		volume, ok := runtime.Volume("data_s1")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(volume.Labels[docker.VolumeGroup], convey.ShouldEqual, "empty")
+		after := containerIds(runtime, "s1")
+		convey.So(after["tpc_db_db_s1"], convey.ShouldNotEqual, before["tpc_db_db_s1"])
+		convey.So(after["tpc_web_web_s1"], convey.ShouldNotEqual, before["tpc_web_web_s1"])
+		convey.So(after["tpc_cache_cache_s1"], convey.ShouldEqual, before["tpc_cache_cache_s1"])
+
+		convey.So(c.RestoreVolume(ctx, "data", "missing"), convey.ShouldNotBeNil)
+		convey.So(c.SnapshotVolume(ctx, "unknown", "clean"), convey.ShouldNotBeNil)
+		convey.So(c.SnapshotVolume(ctx, "data", "../clean"), convey.ShouldNotBeNil)
+	})
+}
+
+const layeredComposeConfig = `
+version: 1
+volumeGroups:
+  - name: base
+    volumes:
+      - name: data
+        path: base
+      - name: assets
+        path: assets
+  - name: refunds
+    extends: orders
+    volumes:
+      - name: data
+        path: refunds
+  - name: orders
+    extends: base
+    volumes:
+      - name: data
+        path: orders
+pods:
+  - name: db
+    containers:
+      - name: db
+        image: mysql
+        volumeMounts:
+          - name: data
+            mountPath: /var/lib/mysql
+  - name: web
+    containers:
+      - name: web
+        image: nginx
+        volumeMounts:
+          - name: assets
+            mountPath: /usr/share/nginx/html
+`
+
+func writeContextFiles(contextPath string, files map[string]string) {
+	for name, content := range files {
+		convey.So(os.MkdirAll(filepath.Dir(filepath.Join(contextPath, name)), 0755), convey.ShouldBeNil)
+		convey.So(os.WriteFile(filepath.Join(contextPath, name), []byte(content), 0644), convey.ShouldBeNil)
+	}
+}
+
+func Test_LayeredVolumeGroup(t *testing.T) {
+	convey.Convey("test a volume group extending another one seeds the base and then its overlay", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		contextPath := t.TempDir()
+		files := map[string]string{
+			"base/init.sql":     "select 1;",
+			"base/users.sql":    "insert users;",
+			"assets/index.html": "<html/>",
+			"orders/orders.sql": "insert orders;",
+			"orders/" + docker.WhiteoutPrefix + "users.sql": "",
+			"refunds/refunds.sql":                           "insert refunds;",
+			"assets/" + docker.WhiteoutPrefix + "keep":      "",
+		}
+		writeContextFiles(contextPath, files)
+		c, err := NewComposeWithRuntime([]byte(layeredComposeConfig), "s1", contextPath, "", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(c.PrepareNetwork(ctx), convey.ShouldBeNil)
+		agent := NewAgent(c)
+		convey.So(c.Start(ctx, agent), convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		// a volume extending no other one keeps its .wh. files
+		convey.So(runtime.VolumeFiles("assets_s1"), convey.ShouldContainKey, docker.WhiteoutPrefix+"keep")
+		before := containerIds(runtime, "s1")
+
+		convey.So(c.SwitchVolumeGroup(ctx, agent, "refunds"), convey.ShouldBeNil)
+		convey.So(runtime.VolumeFiles("data_s1"), convey.ShouldResemble, map[string][]byte{
+			"init.sql":    []byte("select 1;"),
+			"orders.sql":  []byte("insert orders;"),
+			"refunds.sql": []byte("insert refunds;"),
+		})
+		after := containerIds(runtime, "s1")
+		convey.So(after["tpc_db_db_s1"], convey.ShouldNotEqual, before["tpc_db_db_s1"])
+		convey.So(after["tpc_web_web_s1"], convey.ShouldEqual, before["tpc_web_web_s1"])
+		convey.So(agent.GetInfo().VolumeInfos[1].VolumeGroup, convey.ShouldEqual, "refunds")
+	})
+	convey.Convey("test switching back to a group after a restore seeds the volume again", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		contextPath := t.TempDir()
+		writeContextFiles(contextPath, map[string]string{
+			"base/init.sql":       "select 1;",
+			"assets/index.html":   "<html/>",
+			"orders/orders.sql":   "insert orders;",
+			"refunds/refunds.sql": "insert refunds;",
+		})
+		c, err := NewComposeWithRuntime([]byte(layeredComposeConfig), "s1", contextPath, "", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(c.PrepareNetwork(ctx), convey.ShouldBeNil)
+		agent := NewAgent(c)
+		convey.So(c.Start(ctx, agent), convey.ShouldBeNil)
+		defer c.StopPods(ctx)
+		convey.So(c.SwitchVolumeGroup(ctx, agent, "orders"), convey.ShouldBeNil)
+		convey.So(c.SnapshotVolume(ctx, "data", "orders"), convey.ShouldBeNil)
+		convey.So(c.SwitchVolumeGroup(ctx, agent, "refunds"), convey.ShouldBeNil)
+
+		convey.So(c.RestoreVolume(ctx, "data", "orders"), convey.ShouldBeNil)
+		convey.So(runtime.VolumeFiles("data_s1")["refunds.sql"], convey.ShouldBeNil)
+		convey.So(c.GetVolumeInfos()[0].VolumeGroup, convey.ShouldBeEmpty)
+
+		convey.So(c.SwitchVolumeGroup(ctx, agent, "refunds"), convey.ShouldBeNil)
+		convey.So(runtime.VolumeFiles("data_s1")["refunds.sql"], convey.ShouldResemble, []byte("insert refunds;"))
+		convey.So(c.GetVolumeInfos()[0].VolumeGroup, convey.ShouldEqual, "refunds")
+	})
+	convey.Convey("test switching to the group of a volume whose seed failed seeds it again", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		contextPath := t.TempDir()
+		writeContextFiles(contextPath, map[string]string{
+			"base/init.sql":       "select 1;",
+			"assets/index.html":   "<html/>",
+			"orders/orders.sql":   "insert orders;",
+			"refunds/refunds.sql": "insert refunds;",
+		})
+		runtime.OnCopy = func(volumeName string) error {
+			return errors.New("no space left on device")
+		}
+		c, err := NewComposeWithRuntime([]byte(layeredComposeConfig), "s1", contextPath, "", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(c.PrepareNetwork(ctx), convey.ShouldBeNil)
+		agent := NewAgent(c)
+		convey.So(c.Start(ctx, agent), convey.ShouldNotBeNil)
+		defer c.StopPods(ctx)
+		convey.So(c.GetVolumeInfos()[0].VolumeGroup, convey.ShouldBeEmpty)
+
+		runtime.OnCopy = nil
+		convey.So(c.StartPods(ctx), convey.ShouldBeNil)
+		convey.So(c.SwitchVolumeGroup(ctx, agent, "base"), convey.ShouldBeNil)
+		convey.So(runtime.VolumeFiles("data_s1")["init.sql"], convey.ShouldResemble, []byte("select 1;"))
+		convey.So(c.GetVolumeInfos()[0].VolumeGroup, convey.ShouldEqual, "base")
+	})
+	convey.Convey("test an overlay volume overrides the cache and readOnly of its base", t, func() {
+		enabled, disabled := true, false
+		base := &VolumeConfig{Name: "data", Path: "base", Cache: &enabled, ReadOnly: &enabled}
+		inherited := (&VolumeConfig{Name: "data", Path: "orders"}).extend(base)
+		convey.So(inherited.cached(), convey.ShouldBeTrue)
+		convey.So(inherited.readOnly(), convey.ShouldBeTrue)
+		overridden := (&VolumeConfig{Name: "data", Path: "orders", Cache: &disabled, ReadOnly: &disabled}).extend(base)
+		convey.So(overridden.cached(), convey.ShouldBeFalse)
+		convey.So(overridden.readOnly(), convey.ShouldBeFalse)
+		convey.So(overridden.sameSource(inherited), convey.ShouldBeFalse)
+	})
+	convey.Convey("test the extends chain is validated", t, func() {
+		cycle := strings.Replace(layeredComposeConfig, "name: base\n", "name: base\n    extends: refunds\n", 1)
+		_, err := NewComposeWithRuntime([]byte(cycle), "s1", t.TempDir(), "", fake.NewRuntime())
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldContainSubstring, "extends itself")
+
+		missing := strings.Replace(layeredComposeConfig, "extends: base", "extends: unknown", 1)
+		_, err = NewComposeWithRuntime([]byte(missing), "s1", t.TempDir(), "", fake.NewRuntime())
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldContainSubstring, "unknown")
+	})
+}
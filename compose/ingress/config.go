@@ -3,8 +3,14 @@ package ingress
 import (
 	"fmt"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"strconv"
+	"strings"
 )
 
+// EnvoyConfigFileName is the file the ingress container reads its config from
+const EnvoyConfigFileName = "envoy.yaml"
+
 type EnvoyConfig struct {
 	port            map[int]int
 	StaticResources *StaticResources `json:"static_resources" yaml:"static_resources"`
@@ -124,3 +130,27 @@ func (e *EnvoyConfig) AddExposePort(podName string, port int, exposePort int) er
 	e.StaticResources.Clusters = append(e.StaticResources.Clusters, cluster)
 	return nil
 }
+
+// BuildEnvoyConfig returns the envoy.yaml of the service port mappings, e.g. web=80:8080
+func BuildEnvoyConfig(servicePortMap map[string]string) ([]byte, error) {
+	config := NewEnvoyConfig()
+	for serviceName, portMapping := range servicePortMap {
+		portMappingSplit := strings.SplitN(portMapping, ":", 2)
+		if len(portMappingSplit) != 2 {
+			return nil, errors.Errorf("invalid port mapping %s of %s", portMapping, serviceName)
+		}
+		sourcePort, err := strconv.Atoi(portMappingSplit[0])
+		if err != nil {
+			return nil, err
+		}
+		targetPort, err := strconv.Atoi(portMappingSplit[1])
+		if err != nil {
+			return nil, err
+		}
+		err = config.AddExposePort(serviceName, sourcePort, targetPort)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return yaml.Marshal(config)
+}
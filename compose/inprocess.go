@@ -0,0 +1,17 @@
+package compose
+
+import (
+	"context"
+	"podcompose/compose/ingress"
+	"podcompose/docker"
+)
+
+// seedIngressVolume writes the envoy config of the service ports into the ingress volume, like the ingress volume agent does
+func (a *Agent) seedIngressVolume(ctx context.Context, volumeId string, servicePortInfo map[string]string) error {
+	content, err := ingress.BuildEnvoyConfig(servicePortInfo)
+	if err != nil {
+		return err
+	}
+	return a.composeProvider.GetRuntime().CopyToVolume(ctx, volumeId, a.GetSessionId(),
+		docker.ArchiveFile(ingress.EnvoyConfigFileName, content, 0766))
+}
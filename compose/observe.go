@@ -3,72 +3,166 @@ package compose
 import (
 	"context"
 	"fmt"
+	"github.com/docker/docker/api/types/events"
 	"go.uber.org/zap"
 	"podcompose/common"
 	"podcompose/docker"
 	"podcompose/event"
+	"podcompose/metrics"
+	"strings"
 	"time"
 )
 
+const observeRetryInterval = time.Second
+
+var observeActions = []string{"start", "kill", "die", "oom", "health_status", "destroy"}
+
+// Observe watches the docker events stream of a session and publishes the container state changes
 type Observe struct {
-	ids   map[string]string
-	cache map[string]event.ContainerEventData
+	provider  docker.Runtime
+	sessionId string
+	cancel    context.CancelFunc
+	done      chan struct{}
+	// killed records the containers stopped on purpose, their die event is not an error
+	killed map[string]bool
+	// started records the ids of the pod containers already started once, a start of the same id is a restart
+	// while a container recreated by a restart, switch or restore of the pods has a new id
+	started map[string]bool
+}
+
+func NewObserve(provider docker.Runtime, sessionId string) *Observe {
+	return &Observe{
+		provider:  provider,
+		sessionId: sessionId,
+		killed:    make(map[string]bool),
+		started:   make(map[string]bool),
+	}
 }
 
-func (o *Observe) Start(provider *docker.DockerProvider) {
-	o.ids = make(map[string]string)
-	o.cache = make(map[string]event.ContainerEventData)
+// Start runs the watcher in background until ctx is done or Stop is called
+func (o *Observe) Start(ctx context.Context) {
+	ctx, o.cancel = context.WithCancel(ctx)
+	o.done = make(chan struct{})
 	go func() {
+		defer close(o.done)
 		zap.L().Debug("Start observe")
-		ctx := context.Background()
-		for true {
-			for index, id := range o.ids {
-				inspect, err := provider.ContainerInspect(ctx, id)
-				if err != nil {
-					delete(o.ids, index)
-					continue
-				}
-				eventData := event.ContainerEventData{
-					PodName:       inspect.Config.Labels[common.LabelPodName],
-					ContainerName: inspect.Config.Labels[common.LabelContainerName],
-					Id:            id,
-					Name:          inspect.Name,
-					Image:         inspect.Image,
-					Type:          event.ContainerEventStateType,
-					State:         inspect.State,
-				}
-				if !o.isRepeat(eventData) {
-					event.Publish(&eventData)
-				}
-				if inspect.State.Running == false && inspect.State.ExitCode != 0 {
-					event.Publish(&event.ErrorData{
-						Reason:  "Error exit code",
-						Message: fmt.Sprintf("Pod [%s] Container [%s] is dead and exit code is not 0", inspect.Config.Labels[common.LabelPodName], inspect.Config.Labels[common.LabelContainerName]),
-					})
-				}
-			}
-			time.Sleep(time.Second)
-		}
+		o.watch(ctx)
+		zap.L().Debug("Stop observe")
 	}()
 }
 
-func (o *Observe) observeContainerId(id string) {
-	o.ids[id] = id
+// Stop cancels the watcher and waits for it to exit
+func (o *Observe) Stop() {
+	if o.cancel == nil {
+		return
+	}
+	o.cancel()
+	<-o.done
 }
 
-func (o *Observe) isRepeat(data event.ContainerEventData) bool {
-	old, ok := o.cache[data.Name]
-	if ok {
-		if old.Id != data.Id {
-			o.cache[data.Name] = data
-			return false
+func (o *Observe) watch(ctx context.Context) {
+	since := ""
+	var last int64
+	for {
+		messages, errs := o.provider.ContainerEvents(ctx, o.sessionId, since, observeActions...)
+	RECEIVE:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-messages:
+				if msg.TimeNano != 0 {
+					if msg.TimeNano <= last {
+						// replayed by the reconnect
+						continue
+					}
+					last = msg.TimeNano
+					// resume from the last received event when the stream is reconnected
+					since = fmt.Sprintf("%d.%09d", last/int64(time.Second), last%int64(time.Second))
+				}
+				o.handle(ctx, msg)
+			case err := <-errs:
+				if ctx.Err() != nil {
+					return
+				}
+				zap.L().Sugar().Warnf("observe docker events error, reconnect: %s", err)
+				break RECEIVE
+			}
 		}
-		if old.State.Status != data.State.Status {
-			o.cache[data.Name] = data
-			return false
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(observeRetryInterval):
+		}
+	}
+}
+
+func (o *Observe) handle(ctx context.Context, msg events.Message) {
+	action := eventAction(msg)
+	if action == "kill" {
+		o.killed[msg.Actor.ID] = true
+		return
+	}
+	eventData, ok := toContainerEventData(msg)
+	if !ok {
+		return
+	}
+	if action != "destroy" {
+		inspect, err := o.provider.ContainerInspect(ctx, msg.Actor.ID)
+		if err == nil {
+			eventData.State = inspect.State
 		}
 	} else {
-		o.cache[data.Name] = data
+		delete(o.killed, msg.Actor.ID)
+		delete(o.started, msg.Actor.ID)
+	}
+	event.Publish(ctx, eventData)
+	if action == "die" && !o.killed[msg.Actor.ID] && msg.Actor.Attributes["exitCode"] != "0" {
+		event.Publish(ctx, &event.ErrorData{
+			Reason:  "Error exit code",
+			Message: fmt.Sprintf("Pod [%s] Container [%s] is dead and exit code is %s", eventData.PodName, eventData.ContainerName, msg.Actor.Attributes["exitCode"]),
+		})
+	}
+	if action == "start" {
+		delete(o.killed, msg.Actor.ID)
+		if o.started[msg.Actor.ID] {
+			metrics.ContainerRestarts.WithLabelValues(eventData.PodName, eventData.ContainerName).Inc()
+		}
+		o.started[msg.Actor.ID] = true
+	}
+}
+
+func eventAction(msg events.Message) string {
+	return strings.SplitN(msg.Action, ":", 2)[0]
+}
+
+// toContainerEventData converts a docker event to event data, agent containers without a pod are ignored
+func toContainerEventData(msg events.Message) (*event.ContainerEventData, bool) {
+	podName := msg.Actor.Attributes[common.LabelPodName]
+	if podName == "" {
+		return nil, false
+	}
+	var eventType string
+	switch eventAction(msg) {
+	case "start":
+		eventType = event.ContainerEventStateType
+	case "die":
+		eventType = event.ContainerEventDieType
+	case "oom":
+		eventType = event.ContainerEventOOMType
+	case "health_status":
+		eventType = event.ContainerEventHealthType
+	case "destroy":
+		eventType = event.ContainerEventDestroyType
+	default:
+		return nil, false
 	}
-	return true
+	return &event.ContainerEventData{
+		PodName:       podName,
+		ContainerName: msg.Actor.Attributes[common.LabelContainerName],
+		Id:            msg.Actor.ID,
+		Name:          "/" + msg.Actor.Attributes["name"],
+		Image:         msg.Actor.Attributes["image"],
+		Type:          eventType,
+	}, true
 }
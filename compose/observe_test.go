@@ -0,0 +1,167 @@
+package compose
+
+import (
+	"context"
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/smartystreets/goconvey/convey"
+	"podcompose/common"
+	"podcompose/docker/fake"
+	"podcompose/event"
+	"podcompose/metrics"
+	"testing"
+	"time"
+)
+
+func Test_toContainerEventData(t *testing.T) {
+	newMessage := func(action string, attributes map[string]string) events.Message {
+		return events.Message{
+			Type:   events.ContainerEventType,
+			Action: action,
+			Actor: events.Actor{
+				ID:         "id",
+				Attributes: attributes,
+			},
+		}
+	}
+	podAttributes := map[string]string{
+		common.LabelPodName:       "nginx",
+		common.LabelContainerName: "web",
+		"name":                    "tpc_nginx_web_1",
+		"image":                   "nginx:latest",
+	}
+	convey.Convey("test convert docker events", t, func() {
+		eventData, ok := toContainerEventData(newMessage("health_status: healthy", podAttributes))
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(eventData.Type, convey.ShouldEqual, event.ContainerEventHealthType)
+		convey.So(eventData.PodName, convey.ShouldEqual, "nginx")
+		convey.So(eventData.ContainerName, convey.ShouldEqual, "web")
+		convey.So(eventData.Name, convey.ShouldEqual, "/tpc_nginx_web_1")
+		convey.So(eventData.Image, convey.ShouldEqual, "nginx:latest")
+		eventData, ok = toContainerEventData(newMessage("die", podAttributes))
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(eventData.Type, convey.ShouldEqual, event.ContainerEventDieType)
+		eventData, ok = toContainerEventData(newMessage("oom", podAttributes))
+		convey.So(eventData.Type, convey.ShouldEqual, event.ContainerEventOOMType)
+		eventData, ok = toContainerEventData(newMessage("destroy", podAttributes))
+		convey.So(eventData.Type, convey.ShouldEqual, event.ContainerEventDestroyType)
+		_, ok = toContainerEventData(newMessage("exec_start: sh", podAttributes))
+		convey.So(ok, convey.ShouldBeFalse)
+		_, ok = toContainerEventData(newMessage("start", map[string]string{"name": "tpc_agent_1"}))
+		convey.So(ok, convey.ShouldBeFalse)
+	})
+}
+
+func Test_observeRestarts(t *testing.T) {
+	convey.Convey("test only a start of the same container counts as a restart", t, func() {
+		ctx := context.Background()
+		observe := NewObserve(fake.NewRuntime(), "s1")
+		attributes := map[string]string{
+			common.LabelPodName:       "restarts",
+			common.LabelContainerName: "web",
+		}
+		start := func(id string) {
+			observe.handle(ctx, events.Message{Type: events.ContainerEventType, Action: "start", Actor: events.Actor{ID: id, Attributes: attributes}})
+		}
+		restarts := func() float64 {
+			return testutil.ToFloat64(metrics.ContainerRestarts.WithLabelValues("restarts", "web"))
+		}
+		start("a")
+		convey.So(restarts(), convey.ShouldEqual, 0)
+		start("a")
+		convey.So(restarts(), convey.ShouldEqual, 1)
+		// the pod was recreated by a restart, switch or restore
+		start("b")
+		convey.So(restarts(), convey.ShouldEqual, 1)
+	})
+}
+
+func Test_observeHandle(t *testing.T) {
+	convey.Convey("test the observer reports the containers dead with an error exit code", t, func() {
+		_, err := event.ListenEventBus("tcp://127.0.0.1:0")
+		convey.So(err, convey.ShouldBeNil)
+		bus := event.Bus
+		defer func() {
+			_ = bus.Close()
+			event.Bus = nil
+		}()
+		ctx := context.Background()
+		observe := NewObserve(fake.NewRuntime(), "s1")
+		message := func(action string, attributes map[string]string) events.Message {
+			msg := events.Message{Type: events.ContainerEventType, Action: action, Actor: events.Actor{ID: "a", Attributes: map[string]string{
+				common.LabelPodName:       "nginx",
+				common.LabelContainerName: "web",
+			}}}
+			for k, v := range attributes {
+				msg.Actor.Attributes[k] = v
+			}
+			return msg
+		}
+		observe.handle(ctx, message("start", nil))
+		convey.So(bus.History(0, event.Container), convey.ShouldHaveLength, 1)
+		observe.handle(ctx, message("die", map[string]string{"exitCode": "1"}))
+		convey.So(bus.History(0, event.Container), convey.ShouldHaveLength, 2)
+		convey.So(bus.History(0, event.Error), convey.ShouldHaveLength, 1)
+
+		observe.handle(ctx, message("start", nil))
+		observe.handle(ctx, message("kill", map[string]string{"signal": "15"}))
+		observe.handle(ctx, message("die", map[string]string{"exitCode": "143"}))
+		convey.So(bus.History(0, event.Error), convey.ShouldHaveLength, 1)
+		observe.handle(ctx, message("die", map[string]string{"exitCode": "0"}))
+		convey.So(bus.History(0, event.Error), convey.ShouldHaveLength, 1)
+	})
+}
+
+// reconnectRuntime fails the first events stream after its messages and replays the last one on the reconnect
+type reconnectRuntime struct {
+	*fake.Runtime
+	streams [][]events.Message
+	since   chan string
+}
+
+func (r *reconnectRuntime) ContainerEvents(ctx context.Context, sessionId string, since string, actions ...string) (<-chan events.Message, <-chan error) {
+	messages := make(chan events.Message, 8)
+	errs := make(chan error, 1)
+	r.since <- since
+	if len(r.streams) == 0 {
+		return messages, errs
+	}
+	for _, msg := range r.streams[0] {
+		messages <- msg
+	}
+	r.streams = r.streams[1:]
+	go func() {
+		// the messages are received before the stream fails
+		for len(messages) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		errs <- errors.New("unexpected EOF")
+	}()
+	return messages, errs
+}
+
+func Test_observeReconnect(t *testing.T) {
+	convey.Convey("test the observer resumes after the last event when the stream reconnects", t, func() {
+		start := func(id string, timeNano int64) events.Message {
+			return events.Message{Type: events.ContainerEventType, Action: "start", TimeNano: timeNano, Actor: events.Actor{ID: id, Attributes: map[string]string{
+				common.LabelPodName:       "reconnect",
+				common.LabelContainerName: "web",
+			}}}
+		}
+		first := start("a", 1_500_000_000_123_456_789)
+		runtime := &reconnectRuntime{
+			Runtime: fake.NewRuntime(),
+			streams: [][]events.Message{{first}, {first, start("b", 1_500_000_000_223_456_789)}},
+			since:   make(chan string, 4),
+		}
+		observe := NewObserve(runtime, "s1")
+		observe.Start(context.Background())
+		defer observe.Stop()
+		convey.So(<-runtime.since, convey.ShouldEqual, "")
+		convey.So(<-runtime.since, convey.ShouldEqual, "1500000000.123456789")
+		convey.So(<-runtime.since, convey.ShouldEqual, "1500000000.223456789")
+		// a replayed start of the same container would be counted as a restart
+		convey.So(testutil.ToFloat64(metrics.ContainerRestarts.WithLabelValues("reconnect", "web")), convey.ShouldEqual, 0)
+	})
+}
@@ -14,6 +14,8 @@ import (
 	"podcompose/docker"
 	"podcompose/docker/wait"
 	"podcompose/event"
+	"podcompose/metrics"
+	"podcompose/trace"
 	"strings"
 	"sync"
 	"time"
@@ -23,13 +25,15 @@ type PodCompose struct {
 	sessionId       string
 	orderPods       []map[string]*PodConfig
 	network         string
-	dockerProvider  *docker.DockerProvider
+	dockerProvider  docker.Runtime
 	pods            map[string]*PodConfig
 	observe         *Observe
 	hostContextPath string
+	// volumes decides what the volume mounts mount, the session volumes when it is nil
+	volumes *VolumeGroups
 }
 
-func NewPodCompose(sessionID string, hostContextPath string, pods []*PodConfig, network string, dockerProvider *docker.DockerProvider) (*PodCompose, error) {
+func NewPodCompose(sessionID string, hostContextPath string, pods []*PodConfig, network string, dockerProvider docker.Runtime) (*PodCompose, error) {
 	podMap := make(map[string]*PodConfig)
 	for _, pod := range pods {
 		podMap[pod.Name] = pod
@@ -49,8 +53,16 @@ func NewPodCompose(sessionID string, hostContextPath string, pods []*PodConfig,
 	}
 }
 
-func (p *PodCompose) StartTaskGroup(podName string, taskGroup *TaskGroup, ctx context.Context) error {
-	event.Publish(&event.TaskGroupEventData{
+func (p *PodCompose) StartTaskGroup(podName string, taskGroup *TaskGroup, ctx context.Context) (err error) {
+	startTime := time.Now()
+	ctx, span := trace.StartLane(ctx, "task_group")
+	span.SetAttribute("task_group.name", taskGroup.Name)
+	defer func() {
+		span.Finish(err)
+		metrics.TaskGroupRuns.WithLabelValues(taskGroup.Name, metrics.Result(err)).Inc()
+		metrics.TaskGroupDuration.WithLabelValues(taskGroup.Name).Observe(time.Since(startTime).Seconds())
+	}()
+	event.Publish(ctx, &event.TaskGroupEventData{
 		TaskGroupName: taskGroup.Name,
 		Type:          event.TaskGroupEventTaskGroupStart,
 	})
@@ -71,7 +83,7 @@ func (p *PodCompose) StartTaskGroup(podName string, taskGroup *TaskGroup, ctx co
 			p.network: {podName},
 		},
 		Image:    config.ComposeConfig.Image.Pause,
-		Networks: []string{p.dockerProvider.GetDefaultNetwork(), p.network},
+		Networks: sessionNetworks(p.dockerProvider, p.network),
 		CapAdd:   []string{"NET_ADMIN", "NET_RAW"},
 		Labels: map[string]string{
 			common.LabelPodName:       podName,
@@ -86,7 +98,7 @@ func (p *PodCompose) StartTaskGroup(podName string, taskGroup *TaskGroup, ctx co
 		_ = pauseContainer.Terminate(context.Background())
 	}()
 	for _, c := range taskGroup.Tasks {
-		event.Publish(&event.TaskEventData{
+		event.Publish(ctx, &event.TaskEventData{
 			TaskGroupName: taskGroup.Name,
 			TaskName:      c.Name,
 			Type:          event.TaskEventTaskStart,
@@ -95,13 +107,13 @@ func (p *PodCompose) StartTaskGroup(podName string, taskGroup *TaskGroup, ctx co
 		if err != nil {
 			return err
 		}
-		event.Publish(&event.TaskEventData{
+		event.Publish(ctx, &event.TaskEventData{
 			TaskGroupName: taskGroup.Name,
 			TaskName:      c.Name,
 			Type:          event.TaskEventTaskSuccess,
 		})
 	}
-	event.Publish(&event.TaskGroupEventData{
+	event.Publish(ctx, &event.TaskGroupEventData{
 		TaskGroupName: taskGroup.Name,
 		Type:          event.TaskGroupEventTaskGroupSuccess,
 	})
@@ -109,16 +121,26 @@ func (p *PodCompose) StartTaskGroup(podName string, taskGroup *TaskGroup, ctx co
 }
 
 func (p *PodCompose) start(ctx context.Context) error {
-	p.observe = &Observe{}
-	p.observe.Start(p.dockerProvider)
+	p.stop()
+	p.observe = NewObserve(p.dockerProvider, p.sessionId)
+	// the observer outlives the start request, it runs until stop
+	p.observe.Start(context.Background())
 	for _, pods := range p.orderPods {
 		if err := p.concurrencyCreatePods(ctx, pods); err != nil {
+			p.stop()
 			return err
 		}
 	}
 	return nil
 }
 
+func (p *PodCompose) stop() {
+	if p.observe != nil {
+		p.observe.Stop()
+		p.observe = nil
+	}
+}
+
 func (p *PodCompose) concurrencyCreatePods(ctx context.Context, pods map[string]*PodConfig) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -145,8 +167,15 @@ func (p *PodCompose) concurrencyCreatePods(ctx context.Context, pods map[string]
 	}
 }
 
-func (p *PodCompose) createPod(ctx context.Context, pod *PodConfig) error {
-	event.Publish(&event.PodEventData{
+func (p *PodCompose) createPod(ctx context.Context, pod *PodConfig) (err error) {
+	startTime := time.Now()
+	ctx, span := trace.StartLane(ctx, "pod")
+	span.SetAttribute("pod.name", pod.Name)
+	defer func() {
+		span.Finish(err)
+	}()
+	metrics.PodReady.WithLabelValues(pod.Name).Set(0)
+	event.Publish(ctx, &event.PodEventData{
 		PodName: pod.Name,
 		Type:    event.PodEventStartType,
 		Name:    pod.Name,
@@ -154,26 +183,30 @@ func (p *PodCompose) createPod(ctx context.Context, pod *PodConfig) error {
 	containers := make([]docker.Container, 0)
 	// create pause container
 	zap.L().Sugar().Debugf("start pod: %s pause container", pod.Name)
-	pauseContainer, err := p.dockerProvider.RunContainer(ctx, docker.ContainerRequest{
+	pauseCtx, pauseSpan := trace.Start(ctx, "pause_container")
+	pauseContainer, err := p.dockerProvider.RunContainer(pauseCtx, docker.ContainerRequest{
 		Name: common.ContainerNamePrefix + pod.Name + "_pause_" + p.sessionId,
 		NetworkAliases: map[string][]string{
 			p.network: {pod.Name},
 		},
 		Image:    config.ComposeConfig.Image.Pause,
-		Networks: []string{p.dockerProvider.GetDefaultNetwork(), p.network},
+		Networks: sessionNetworks(p.dockerProvider, p.network),
 		DNS:      pod.Dns,
 		Labels: map[string]string{
 			common.LabelPodName:       pod.Name,
 			common.LabelContainerName: "pause",
 		},
 	}, p.sessionId)
+	pauseSpan.Finish(err)
 	if err != nil {
 		return err
 	}
 	containers = append(containers, pauseContainer)
 	for _, c := range pod.InitContainers {
 		zap.L().Sugar().Debugf("start pod: %s init containers: %s", pod.Name, c.Name)
-		createContainer, err := p.runContainer(pod.Name, true, ctx, c, pauseContainer.GetContainerID())
+		initCtx, initSpan := trace.Start(ctx, "init_container")
+		createContainer, err := p.runContainer(pod.Name, true, initCtx, c, pauseContainer.GetContainerID())
+		initSpan.SetAttribute("container.name", c.Name).Finish(err)
 		if err != nil {
 			return err
 		}
@@ -181,7 +214,9 @@ func (p *PodCompose) createPod(ctx context.Context, pod *PodConfig) error {
 	}
 	for _, c := range pod.Containers {
 		zap.L().Sugar().Debugf("start pod: %s containers: %s", pod.Name, c.Name)
-		createContainer, err := p.runContainer(pod.Name, false, ctx, c, pauseContainer.GetContainerID())
+		containerCtx, containerSpan := trace.Start(ctx, "container")
+		createContainer, err := p.runContainer(pod.Name, false, containerCtx, c, pauseContainer.GetContainerID())
+		containerSpan.SetAttribute("container.name", c.Name).Finish(err)
 		if err != nil {
 			return err
 		}
@@ -189,9 +224,10 @@ func (p *PodCompose) createPod(ctx context.Context, pod *PodConfig) error {
 	}
 	for _, c := range containers {
 		collectLogs(c)
-		p.observe.observeContainerId(c.GetContainerID())
 	}
-	event.Publish(&event.PodEventData{
+	metrics.PodStartupDuration.WithLabelValues(pod.Name).Set(time.Since(startTime).Seconds())
+	metrics.PodReady.WithLabelValues(pod.Name).Set(1)
+	event.Publish(ctx, &event.PodEventData{
 		PodName: pod.Name,
 		Type:    event.PodEventReadyType,
 		Name:    pod.Name,
@@ -233,11 +269,17 @@ func (p *PodCompose) createWaitingFor(isInit bool, c *ContainerConfig, podName s
 	return waitingFor
 }
 
+func (p *PodCompose) volumeMount(vm *VolumeMountConfig) docker.ContainerMount {
+	if p.volumes == nil {
+		return docker.VolumeMount(vm.Name+"_"+p.sessionId, docker.ContainerMountTarget(vm.MountPath))
+	}
+	return p.volumes.containerMount(p.sessionId, vm.Name, docker.ContainerMountTarget(vm.MountPath))
+}
+
 func (p *PodCompose) runContainer(podName string, isInit bool, ctx context.Context, c *ContainerConfig, pauseId string) (docker.Container, error) {
 	containerMounts := make([]docker.ContainerMount, 0)
 	for _, vm := range c.VolumeMounts {
-		containerMount := docker.VolumeMount(vm.Name+"_"+p.sessionId, docker.ContainerMountTarget(vm.MountPath))
-		containerMounts = append(containerMounts, containerMount)
+		containerMounts = append(containerMounts, p.volumeMount(vm))
 	}
 	for _, bm := range c.BindMounts {
 		if strings.HasPrefix(bm.HostPath, ".") {
@@ -294,6 +336,9 @@ func (p *PodCompose) foundContainerWithPods(ctx context.Context, pods map[string
 
 func (p *PodCompose) RestartPods(ctx context.Context, pods []string, beforeStart func() error) error {
 	needRestartPods := p.findWhoDependPods(pods, make(map[string]*PodConfig))
+	for podName := range needRestartPods {
+		metrics.PodReady.WithLabelValues(podName).Set(0)
+	}
 	containers, err := p.foundContainerWithPods(ctx, needRestartPods)
 	if err != nil {
 		return err
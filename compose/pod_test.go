@@ -1,7 +1,12 @@
 package compose
 
 import (
+	"context"
+	"github.com/pkg/errors"
 	"github.com/smartystreets/goconvey/convey"
+	"podcompose/docker"
+	"podcompose/docker/fake"
+	"strings"
 	"testing"
 )
 
@@ -73,3 +78,89 @@ func Test_findPodsWhoUsedVolumes(t *testing.T) {
 		convey.So(len(pods), convey.ShouldEqual, 2)
 	})
 }
+
+func Test_PodComposeStart(t *testing.T) {
+	pods := []*PodConfig{
+		{Name: "web", Depends: []string{"api"}, Containers: []*ContainerConfig{{Name: "web", Image: "nginx"}}},
+		{Name: "api", Depends: []string{"db"}, Containers: []*ContainerConfig{{Name: "api", Image: "api"}}},
+		{Name: "db", Containers: []*ContainerConfig{{Name: "db", Image: "mysql"}}},
+	}
+	convey.Convey("test pods start after their depends", t, func() {
+		runtime := fake.NewRuntime()
+		compose, err := NewPodCompose("s1", "", pods, "net", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		err = compose.start(context.Background())
+		defer compose.stop()
+		convey.So(err, convey.ShouldBeNil)
+		started := runtime.Started()
+		convey.So(started, convey.ShouldHaveLength, 6)
+		convey.So(indexOf(started, "tpc_db_db_s1"), convey.ShouldBeLessThan, indexOf(started, "tpc_api_pause_s1"))
+		convey.So(indexOf(started, "tpc_api_api_s1"), convey.ShouldBeLessThan, indexOf(started, "tpc_web_pause_s1"))
+		containers, err := runtime.FindContainers(context.Background(), "s1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(containers, convey.ShouldHaveLength, 6)
+	})
+	convey.Convey("test a failed pod stops the start", t, func() {
+		runtime := fake.NewRuntime()
+		runtime.OnStart = func(req docker.ContainerRequest) error {
+			if req.Name == "tpc_api_api_s1" {
+				return errors.New("boom")
+			}
+			return nil
+		}
+		compose, err := NewPodCompose("s1", "", pods, "net", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		err = compose.start(context.Background())
+		defer compose.stop()
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(indexOf(runtime.Started(), "tpc_web_pause_s1"), convey.ShouldEqual, -1)
+	})
+}
+
+func Test_PodComposeRestart(t *testing.T) {
+	pods := []*PodConfig{
+		{Name: "web", Depends: []string{"api"}, Containers: []*ContainerConfig{{Name: "web", Image: "nginx"}}},
+		{Name: "api", Containers: []*ContainerConfig{{Name: "api", Image: "api"}}},
+		{Name: "cache", Containers: []*ContainerConfig{{Name: "cache", Image: "redis"}}},
+	}
+	convey.Convey("test restart pods and the pods depending on them", t, func() {
+		ctx := context.Background()
+		runtime := fake.NewRuntime()
+		compose, err := NewPodCompose("s1", "", pods, "net", runtime)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(compose.start(ctx), convey.ShouldBeNil)
+		defer compose.stop()
+		before := containerIds(runtime, "s1")
+		err = compose.RestartPods(ctx, []string{"api"}, func() error {
+			// the pods are removed before they are started again
+			containers, _ := runtime.FindContainers(ctx, "s1")
+			convey.So(containers, convey.ShouldHaveLength, 2)
+			return nil
+		})
+		convey.So(err, convey.ShouldBeNil)
+		after := containerIds(runtime, "s1")
+		convey.So(after["tpc_cache_cache_s1"], convey.ShouldEqual, before["tpc_cache_cache_s1"])
+		convey.So(after["tpc_api_api_s1"], convey.ShouldNotEqual, before["tpc_api_api_s1"])
+		convey.So(after["tpc_web_web_s1"], convey.ShouldNotEqual, before["tpc_web_web_s1"])
+		convey.So(after, convey.ShouldHaveLength, 6)
+	})
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// containerIds maps the running container names of the session to their ids
+func containerIds(runtime *fake.Runtime, sessionId string) map[string]string {
+	containers, _ := runtime.FindContainers(context.Background(), sessionId)
+	ids := make(map[string]string)
+	for _, c := range containers {
+		ids[strings.TrimPrefix(c.Names[0], "/")] = c.ID
+	}
+	return ids
+}
@@ -0,0 +1,63 @@
+package compose
+
+import (
+	"os"
+	"podcompose/common"
+	"podcompose/docker"
+)
+
+// hostRuntimeSocket is the engine socket on the host, agents get it from the one that started them
+// because their own socket is always mounted at docker.AgentSocketPath
+func hostRuntimeSocket(runtime docker.Runtime) string {
+	if socket := os.Getenv(common.EnvHostRuntimeSocket); socket != "" {
+		return socket
+	}
+	return runtime.Capabilities().SocketPath
+}
+
+// withRuntime lets an agent container reach the engine, a local socket is mounted and engines
+// listening on an address are passed by DOCKER_HOST with the tls material Compose.ShipContext copied
+func withRuntime(runtime docker.Runtime, sessionId string, req docker.ContainerRequest) docker.ContainerRequest {
+	if req.Env == nil {
+		req.Env = make(map[string]string)
+	}
+	if runtime.Capabilities().Remote {
+		req.Env[docker.RemoteEnv] = "true"
+	}
+	socket := hostRuntimeSocket(runtime)
+	if socket == "" {
+		req.Env[docker.Host] = runtime.Capabilities().Host
+		if os.Getenv(docker.CertPathEnv) != "" {
+			req.Mounts = append(req.Mounts, docker.VolumeMount(common.CertVolumeName+"_"+sessionId, common.AgentCertPath))
+			req.Env[docker.CertPathEnv] = common.AgentCertPath
+			req.Env[docker.TLSVerifyEnv] = os.Getenv(docker.TLSVerifyEnv)
+		}
+		return req
+	}
+	req.Mounts = append(req.Mounts, docker.BindMount(socket, docker.AgentSocketPath))
+	req.Env[docker.Host] = "unix://" + docker.AgentSocketPath
+	req.Env[common.EnvHostRuntimeSocket] = socket
+	if runtime.Capabilities().IsPodman() {
+		// selinux denies the socket to containers of podman
+		req.SecurityOpt = append(req.SecurityOpt, "label=disable")
+	}
+	return req
+}
+
+// contextMount is the context directory of the agents, a remote engine can not see the paths of this machine
+// so it gets the copy Compose.ShipContext made
+func contextMount(runtime docker.Runtime, sessionId string, contextPath string) docker.ContainerMount {
+	if runtime.Capabilities().Remote {
+		return docker.VolumeMount(common.ContextVolumeName+"_"+sessionId, common.AgentContextPath)
+	}
+	return docker.BindMount(contextPath, common.AgentContextPath)
+}
+
+// sessionNetworks are the networks of pause and agent containers, the default network of podman has no dns
+// and rootless podman can not join it together with another one, so only the session network is used there
+func sessionNetworks(runtime docker.Runtime, network string) []string {
+	if runtime.Capabilities().IsPodman() {
+		return []string{network}
+	}
+	return []string{runtime.GetDefaultNetwork(), network}
+}
@@ -0,0 +1,135 @@
+package compose
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"path/filepath"
+	"podcompose/docker"
+	"podcompose/event"
+	"strings"
+	"sync"
+	"time"
+)
+
+// seedProgressInterval bounds how often the progress of a volume is published
+const seedProgressInterval = time.Second
+
+// seedVolumes streams the data directories and archive files of the context into the volumes through the archive api
+// of the runtime, the progress of every volume is published on the volume topic
+func (a *Agent) seedVolumes(ctx context.Context, volumes []*VolumeConfig) error {
+	for _, volume := range volumes {
+		if len(volume.sources()) == 0 {
+			continue
+		}
+		if err := a.seedVolume(ctx, volume); err != nil {
+			return errors.Wrapf(err, "seed volume %s", volume.Name)
+		}
+	}
+	return nil
+}
+
+func (a *Agent) seedVolume(ctx context.Context, volume *VolumeConfig) error {
+	options, err := volume.archiveOptions()
+	if err != nil {
+		return err
+	}
+	srcs := make([]string, 0)
+	for _, source := range volume.sources() {
+		srcs = append(srcs, filepath.Join(a.composeProvider.GetContextPath(), source))
+	}
+	if volume.cached() {
+		return a.seedVolumeFromCache(ctx, volume, srcs, options)
+	}
+	return a.copyVolume(ctx, volume, srcs, options, "", func(archive io.Reader) error {
+		return a.composeProvider.GetRuntime().CopyToVolume(ctx, volume.Name, a.GetSessionId(), archive)
+	})
+}
+
+// seedVolumeFromCache fills the cache volume of the content hash of the layers when there is none yet and clones it
+// into the volume, a read only volume mounts the cache volume itself
+func (a *Agent) seedVolumeFromCache(ctx context.Context, volume *VolumeConfig, srcs []string, options docker.ArchiveOptions) error {
+	runtime := a.composeProvider.GetRuntime()
+	hash, err := hashSources(volume, srcs, options)
+	if err != nil {
+		return errors.Wrap(err, "hash")
+	}
+	cache, err := runtime.FindCacheVolume(ctx, hash)
+	if err != nil {
+		return err
+	}
+	use := func(cacheName string) error {
+		if volume.readOnly() {
+			a.composeProvider.SetVolumeSource(volume.Name, cacheName)
+			return nil
+		}
+		return errors.Wrapf(runtime.CloneVolume(ctx, cacheName, volume.Name, a.GetSessionId()), "clone %s", cacheName)
+	}
+	if cache == nil {
+		cacheName := docker.CacheVolumeName(hash, a.GetSessionId())
+		return a.copyVolume(ctx, volume, srcs, options, cacheName, func(archive io.Reader) error {
+			if _, err := runtime.CreateCacheVolume(ctx, hash, strings.Join(volume.sources(), "+"), a.GetSessionId(), archive); err != nil {
+				return err
+			}
+			return use(cacheName)
+		})
+	}
+	event.Publish(ctx, &event.VolumeEventData{Type: event.VolumeEventSeedCached, Name: volume.Name, Cache: cache.Name})
+	if err = use(cache.Name); err != nil {
+		event.Publish(ctx, &event.VolumeEventData{Type: event.VolumeEventSeedFail, Name: volume.Name, Cache: cache.Name, Error: err.Error()})
+		return err
+	}
+	event.Publish(ctx, &event.VolumeEventData{Type: event.VolumeEventSeedSuccess, Name: volume.Name, Cache: cache.Name})
+	return nil
+}
+
+// copyVolume streams the layers to copy and publishes the start, progress and result of the copy, cache is the cache
+// volume being filled if any
+func (a *Agent) copyVolume(ctx context.Context, volume *VolumeConfig, srcs []string, options docker.ArchiveOptions, cache string, copy func(archive io.Reader) error) error {
+	// the archive is written by another goroutine
+	var lock sync.Mutex
+	var files int
+	var bytes int64
+	lastProgress := time.Now()
+	options.Progress = func(f int, b int64) {
+		lock.Lock()
+		files, bytes = f, b
+		publish := time.Since(lastProgress) >= seedProgressInterval
+		if publish {
+			lastProgress = time.Now()
+		}
+		lock.Unlock()
+		if publish {
+			event.Publish(ctx, &event.VolumeEventData{Type: event.VolumeEventSeedProgress, Name: volume.Name, Files: f, Bytes: b, Cache: cache})
+		}
+	}
+	event.Publish(ctx, &event.VolumeEventData{Type: event.VolumeEventSeedStart, Name: volume.Name, Cache: cache})
+	archive := archiveSources(volume, srcs, options)
+	err := copy(archive)
+	_ = archive.Close()
+	lock.Lock()
+	defer lock.Unlock()
+	if err != nil {
+		event.Publish(ctx, &event.VolumeEventData{Type: event.VolumeEventSeedFail, Name: volume.Name, Files: files, Bytes: bytes, Cache: cache, Error: err.Error()})
+		return err
+	}
+	event.Publish(ctx, &event.VolumeEventData{Type: event.VolumeEventSeedSuccess, Name: volume.Name, Files: files, Bytes: bytes, Cache: cache})
+	return nil
+}
+
+// archiveSources merges the layers of an extended volume, the source of any other volume is archived as it is
+// so its .wh. files are kept and the hash of its cache volume does not change, see docker.ArchiveLayers
+func archiveSources(volume *VolumeConfig, srcs []string, options docker.ArchiveOptions) io.ReadCloser {
+	if volume.extended() {
+		return docker.ArchiveLayers(srcs, options)
+	}
+	return docker.ArchiveSource(srcs[0], options)
+}
+
+// hashSources is the content hash of what archiveSources writes
+func hashSources(volume *VolumeConfig, srcs []string, options docker.ArchiveOptions) (string, error) {
+	if volume.extended() {
+		return docker.HashLayers(srcs, options)
+	}
+	return docker.HashSource(srcs[0], options)
+}
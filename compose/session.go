@@ -0,0 +1,79 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SessionLock lets one mutating operation at a time change the pods, volumes and ingresses of the session
+type SessionLock struct {
+	sem    chan struct{}
+	lock   sync.Mutex
+	holder SessionHolder
+}
+
+// SessionHolder is the operation holding the session lock
+type SessionHolder struct {
+	OperationId string
+	Name        string
+}
+
+// ConflictError is returned when the session lock is held by another operation
+type ConflictError struct {
+	Holder SessionHolder
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("operation %s (%s) is running on the session", e.Holder.OperationId, e.Holder.Name)
+}
+
+func NewSessionLock() *SessionLock {
+	return &SessionLock{
+		sem: make(chan struct{}, 1),
+	}
+}
+
+// TryAcquire takes the lock for holder or returns a *ConflictError at once
+func (s *SessionLock) TryAcquire(holder SessionHolder) (func(), error) {
+	select {
+	case s.sem <- struct{}{}:
+		return s.hold(holder), nil
+	default:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return nil, &ConflictError{Holder: s.holder}
+	}
+}
+
+// Acquire waits for the lock, waiters are not served in arrival order, it gives up when ctx is done
+func (s *SessionLock) Acquire(ctx context.Context, holder SessionHolder) (func(), error) {
+	select {
+	case s.sem <- struct{}{}:
+		return s.hold(holder), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Holder returns the operation holding the lock, false when the lock is free
+func (s *SessionLock) Holder() (SessionHolder, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.holder, s.holder != SessionHolder{}
+}
+
+func (s *SessionLock) hold(holder SessionHolder) func() {
+	s.lock.Lock()
+	s.holder = holder
+	s.lock.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.lock.Lock()
+			s.holder = SessionHolder{}
+			s.lock.Unlock()
+			<-s.sem
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package compose
+
+import (
+	"context"
+	"github.com/smartystreets/goconvey/convey"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_sessionLock(t *testing.T) {
+	convey.Convey("test session lock", t, func() {
+		session := NewSessionLock()
+		release, err := session.TryAcquire(SessionHolder{OperationId: "1", Name: "restart"})
+		convey.So(err, convey.ShouldBeNil)
+		holder, ok := session.Holder()
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(holder.OperationId, convey.ShouldEqual, "1")
+
+		_, err = session.TryAcquire(SessionHolder{OperationId: "2", Name: "switch"})
+		conflictError, ok := err.(*ConflictError)
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(conflictError.Holder.Name, convey.ShouldEqual, "restart")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = session.Acquire(ctx, SessionHolder{OperationId: "2", Name: "switch"})
+		convey.So(err, convey.ShouldResemble, context.DeadlineExceeded)
+
+		release()
+		release()
+		_, ok = session.Holder()
+		convey.So(ok, convey.ShouldBeFalse)
+		release, err = session.TryAcquire(SessionHolder{OperationId: "3", Name: "ingress"})
+		convey.So(err, convey.ShouldBeNil)
+		release()
+	})
+	convey.Convey("test session lock serializes the waiting operations", t, func() {
+		session := NewSessionLock()
+		var running, overlaps int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := session.Acquire(context.Background(), SessionHolder{Name: "restart"})
+				if err != nil {
+					return
+				}
+				defer release()
+				if atomic.AddInt32(&running, 1) > 1 {
+					atomic.AddInt32(&overlaps, 1)
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			}()
+		}
+		wg.Wait()
+		convey.So(overlaps, convey.ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,207 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net/http"
+	"podcompose/event"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SignatureHeader = "X-Tpc-Signature"
+const EventTopicHeader = "X-Tpc-Event-Topic"
+const EventSeqHeader = "X-Tpc-Event-Seq"
+
+const sinkDefaultMaxRetries = 3
+const sinkQueueSize = 1024
+const sinkRetryInterval = time.Second
+const sinkMaxRetryInterval = 30 * time.Second
+const sinkRequestTimeout = 10 * time.Second
+
+// sinkStopTimeout bounds the time given to the queued deliveries when the sinks stop
+const sinkStopTimeout = 10 * time.Second
+
+// EventSinks posts the events of the bus to the configured webhooks, every sink has its own queue
+// so that a slow webhook does not delay the others, and the publisher is never blocked
+type EventSinks struct {
+	sinks        []*eventSink
+	subscription *event.Subscription
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+type eventSink struct {
+	config     *EventSinkConfig
+	httpClient *http.Client
+	queue      chan *event.Record
+}
+
+func NewEventSinks(configs []*EventSinkConfig) *EventSinks {
+	sinks := make([]*eventSink, len(configs))
+	for i, config := range configs {
+		sinks[i] = &eventSink{
+			config:     config,
+			httpClient: &http.Client{Timeout: sinkRequestTimeout},
+			queue:      make(chan *event.Record, sinkQueueSize),
+		}
+	}
+	return &EventSinks{sinks: sinks}
+}
+
+// Start delivers the events published on the bus until Stop is called
+func (e *EventSinks) Start(bus *event.EventBus) {
+	if len(e.sinks) == 0 || bus == nil || e.subscription != nil {
+		return
+	}
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(context.Background())
+	e.subscription = bus.Subscribe()
+	for _, sink := range e.sinks {
+		sink := sink
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			for record := range sink.queue {
+				if err := sink.deliver(ctx, record); err != nil {
+					zap.L().Sugar().Errorf("deliver event %d to %s error: %s", record.Seq, sink.config.Url, err)
+				}
+			}
+		}()
+	}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer func() {
+			for _, sink := range e.sinks {
+				close(sink.queue)
+			}
+		}()
+		for record := range e.subscription.C {
+			var eventMsg event.EventMsg
+			if err := json.Unmarshal(record.Data, &eventMsg); err != nil {
+				continue
+			}
+			for _, sink := range e.sinks {
+				if !sink.match(&eventMsg) {
+					continue
+				}
+				select {
+				case sink.queue <- record:
+				default:
+					zap.L().Sugar().Warnf("event sink %s is full, drop event %d", sink.config.Url, record.Seq)
+				}
+			}
+		}
+	}()
+}
+
+// Stop delivers the queued events, the deliveries still running after sinkStopTimeout are canceled
+func (e *EventSinks) Stop() {
+	if e.subscription == nil {
+		return
+	}
+	e.subscription.Close()
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(sinkStopTimeout):
+		e.cancel()
+		<-done
+	}
+	e.cancel()
+}
+
+func (s *eventSink) match(eventMsg *event.EventMsg) bool {
+	if len(s.config.Topics) > 0 && !contains(s.config.Topics, eventMsg.Topic) {
+		return false
+	}
+	if len(s.config.Types) == 0 {
+		return true
+	}
+	eventType := eventMsg.Type()
+	for _, t := range s.config.Types {
+		if eventType == t || strings.HasPrefix(eventType, t+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver posts the record, server errors and connection errors are retried with an exponential backoff
+func (s *eventSink) deliver(ctx context.Context, record *event.Record) error {
+	maxRetries := sinkDefaultMaxRetries
+	if s.config.MaxRetries != nil {
+		maxRetries = *s.config.MaxRetries
+	}
+	interval := sinkRetryInterval
+	for retry := 0; ; retry++ {
+		retryable, err := s.post(ctx, record)
+		if err == nil {
+			return nil
+		}
+		if !retryable || retry >= maxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > sinkMaxRetryInterval {
+			interval = sinkMaxRetryInterval
+		}
+	}
+}
+
+func (s *eventSink) post(ctx context.Context, record *event.Record) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.Url, bytes.NewReader(record.Data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventTopicHeader, record.Topic)
+	req.Header.Set(EventSeqHeader, strconv.FormatUint(record.Seq, 10))
+	if s.config.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.config.Secret, record.Data))
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+	err = errors.Errorf("webhook response status %d", resp.StatusCode)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// Sign returns the X-Tpc-Signature header value of the body, "sha256=" followed by the hex HMAC-SHA256
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package compose
+
+import (
+	"context"
+	"github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"podcompose/event"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_eventSinkMatch(t *testing.T) {
+	convey.Convey("test event sink filter", t, func() {
+		sink := &eventSink{config: &EventSinkConfig{
+			Topics: []string{event.Compose, event.Error},
+			Types:  []string{event.ComposeEventStartFailType, event.ComposeEventTaskGroupSuccess, event.Error},
+		}}
+		convey.So(sink.match(&event.EventMsg{Topic: event.Compose, ComposeEventData: &event.ComposeEventData{Type: event.ComposeEventStartFailType}}), convey.ShouldBeTrue)
+		convey.So(sink.match(&event.EventMsg{Topic: event.Compose, ComposeEventData: &event.ComposeEventData{Type: event.ComposeEventTaskGroupSuccess + ":init"}}), convey.ShouldBeTrue)
+		convey.So(sink.match(&event.EventMsg{Topic: event.Error, ErrorData: &event.ErrorData{Reason: "die"}}), convey.ShouldBeTrue)
+		convey.So(sink.match(&event.EventMsg{Topic: event.Compose, ComposeEventData: &event.ComposeEventData{Type: event.ComposeEventStartSuccessType}}), convey.ShouldBeFalse)
+		convey.So(sink.match(&event.EventMsg{Topic: event.Pod, PodEventData: &event.PodEventData{Type: event.PodEventReadyType}}), convey.ShouldBeFalse)
+	})
+}
+
+func Test_eventSinkDeliver(t *testing.T) {
+	convey.Convey("test event sink delivery", t, func() {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get(SignatureHeader) != Sign("secret", body) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			// the first delivery fails and is retried
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		record := &event.Record{Seq: 1, Topic: event.Compose, Data: []byte(`{"Seq":1,"Topic":"compose"}`)}
+		sink := &eventSink{config: &EventSinkConfig{Url: server.URL, Secret: "secret"}, httpClient: server.Client()}
+		convey.So(sink.deliver(context.Background(), record), convey.ShouldBeNil)
+		convey.So(atomic.LoadInt32(&requests), convey.ShouldEqual, 2)
+
+		sink = &eventSink{config: &EventSinkConfig{Url: server.URL, Secret: "wrong"}, httpClient: server.Client()}
+		convey.So(sink.deliver(context.Background(), record), convey.ShouldNotBeNil)
+		convey.So(atomic.LoadInt32(&requests), convey.ShouldEqual, 2)
+	})
+	convey.Convey("test event sink without retries posts once", t, func() {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+		config := &ComposeConfig{}
+		convey.So(yaml.Unmarshal([]byte("eventSinks:\n  - url: "+server.URL+"\n    maxRetries: 0\n"), config), convey.ShouldBeNil)
+		record := &event.Record{Seq: 1, Topic: event.Compose, Data: []byte(`{"Seq":1,"Topic":"compose"}`)}
+		sink := &eventSink{config: config.EventSinks[0], httpClient: server.Client()}
+		convey.So(sink.deliver(context.Background(), record), convey.ShouldNotBeNil)
+		convey.So(atomic.LoadInt32(&requests), convey.ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,123 @@
+package compose
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"podcompose/docker"
+	"regexp"
+)
+
+// snapshotNamePattern keeps the snapshot volume name a valid docker volume name
+var snapshotNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// HasVolume is true when the volume is declared in the volumes or in a volume group
+func (c *Compose) HasVolume(name string) bool {
+	for _, volume := range c.config.Volumes {
+		if volume.Name == name {
+			return true
+		}
+	}
+	for _, group := range c.config.VolumeGroups {
+		for _, volume := range group.Volumes {
+			if volume.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Compose) checkSnapshot(name string, snapshot string) error {
+	if !c.HasVolume(name) {
+		return errors.Errorf("not found volume %s", name)
+	}
+	if !snapshotNamePattern.MatchString(snapshot) {
+		return errors.Errorf("invalid snapshot name %s", snapshot)
+	}
+	if c.volume.isReadOnly(name) {
+		return errors.Errorf("volume %s is read only", name)
+	}
+	return nil
+}
+
+// FindSnapshot returns the snapshot volume of the volume, nil when there is none
+func (c *Compose) FindSnapshot(ctx context.Context, name string, snapshot string) (*types.Volume, error) {
+	return c.findVolume(ctx, docker.SnapshotVolumeName(name, snapshot)+"_"+c.GetSessionId())
+}
+
+func (c *Compose) findVolume(ctx context.Context, fullName string) (*types.Volume, error) {
+	volumes, err := c.dockerProvider.FindAllVolumesWithSessionId(ctx, c.GetSessionId())
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range volumes {
+		if v.Name == fullName {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// SnapshotVolume copies the volume into the snapshot volume of the name, an existing snapshot of the name
+// is replaced, the pods keep running so the snapshot is best taken while they are idle
+func (c *Compose) SnapshotVolume(ctx context.Context, name string, snapshot string) error {
+	if err := c.checkSnapshot(name, snapshot); err != nil {
+		return err
+	}
+	existing, err := c.FindSnapshot(ctx, name, snapshot)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if err = c.dockerProvider.RemoveVolume(ctx, existing.Name, c.GetSessionId(), true); err != nil {
+			return err
+		}
+	}
+	v, err := c.dockerProvider.CreateSnapshotVolume(ctx, name, snapshot, c.GetSessionId())
+	if err != nil {
+		return err
+	}
+	return c.dockerProvider.CloneVolume(ctx, name+"_"+c.GetSessionId(), v.Name, c.GetSessionId())
+}
+
+// RestoreVolume restarts the pods using the volume with the data of the snapshot, the volume is recreated
+// while they are removed, the other pods keep running, the volume holds no group afterwards so that
+// switching to any group seeds it again
+func (c *Compose) RestoreVolume(ctx context.Context, name string, snapshot string) error {
+	if err := c.checkSnapshot(name, snapshot); err != nil {
+		return err
+	}
+	source, err := c.FindSnapshot(ctx, name, snapshot)
+	if err != nil {
+		return err
+	}
+	if source == nil {
+		return errors.Errorf("not found snapshot %s of volume %s", snapshot, name)
+	}
+	current, err := c.findVolume(ctx, name+"_"+c.GetSessionId())
+	if err != nil {
+		return err
+	}
+	volumeGroup := ""
+	if current != nil {
+		volumeGroup = current.Labels[docker.VolumeGroup]
+	}
+	pods := c.FindPodsWhoUsedVolumes([]string{name})
+	podNames := make([]string, len(pods))
+	for k, v := range pods {
+		podNames[k] = v.Name
+	}
+	return c.RestartPods(ctx, podNames, func() error {
+		c.volume.deactivate(name)
+		if current != nil {
+			if err := c.dockerProvider.RemoveVolume(ctx, name, c.GetSessionId(), true); err != nil {
+				return err
+			}
+		}
+		if _, err := c.dockerProvider.CreateVolume(ctx, name, c.GetSessionId(), volumeGroup); err != nil {
+			return err
+		}
+		return c.dockerProvider.CloneVolume(ctx, source.Name, name, c.GetSessionId())
+	})
+}
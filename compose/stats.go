@@ -0,0 +1,306 @@
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/docker/docker/api/types"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"podcompose/common"
+	"podcompose/docker"
+	"podcompose/event"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const statsPublishInterval = 10 * time.Second
+
+// Stats streams the resource usage of every pod container and keeps the peak usage per pod
+type Stats struct {
+	provider   docker.Runtime
+	sessionId  string
+	lock       sync.Mutex
+	containers map[string]*common.ContainerStats
+	podNames   map[string]string
+	peaks      map[string]*common.ResourceUsage
+	// run guards cancel, Stop and Finish may be called by the api and the compose at the same time
+	run    sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewStats(provider docker.Runtime, sessionId string) *Stats {
+	return &Stats{
+		provider:   provider,
+		sessionId:  sessionId,
+		containers: make(map[string]*common.ContainerStats),
+		podNames:   make(map[string]string),
+		peaks:      make(map[string]*common.ResourceUsage),
+	}
+}
+
+// Start collects stats in background until Stop is called, the running containers are discovered at start,
+// new containers are discovered and stats events are published every statsPublishInterval
+func (s *Stats) Start() {
+	s.run.Lock()
+	defer s.run.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(statsPublishInterval)
+		defer ticker.Stop()
+		s.discover(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.discover(ctx)
+				event.Publish(ctx, &event.StatsEventData{
+					Type:     event.StatsEventUsage,
+					PodStats: s.GetPodStats(),
+				})
+			}
+		}
+	}()
+}
+
+func (s *Stats) Stop() {
+	s.run.Lock()
+	defer s.run.Unlock()
+	s.stop()
+}
+
+func (s *Stats) stop() bool {
+	if s.cancel == nil {
+		return false
+	}
+	s.cancel()
+	s.wg.Wait()
+	s.cancel = nil
+	return true
+}
+
+// Finish stops the stats and writes the summary into dir like WriteSummary, it does nothing when the stats
+// are already stopped so the summary is written once per Start
+func (s *Stats) Finish(dir string) error {
+	s.run.Lock()
+	defer s.run.Unlock()
+	if !s.stop() {
+		return nil
+	}
+	return s.WriteSummary(dir)
+}
+
+func (s *Stats) discover(ctx context.Context) {
+	cs, err := s.provider.FindAllContainersWithSessionId(ctx, s.sessionId)
+	if err != nil {
+		return
+	}
+	for _, c := range cs {
+		podName := c.Labels[common.LabelPodName]
+		if podName == "" || c.State != "running" {
+			continue
+		}
+		s.lock.Lock()
+		_, ok := s.podNames[c.ID]
+		if !ok {
+			s.podNames[c.ID] = podName
+		}
+		s.lock.Unlock()
+		if ok {
+			continue
+		}
+		c := c
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.follow(ctx, c)
+		}()
+	}
+}
+
+func (s *Stats) follow(ctx context.Context, c types.Container) {
+	defer func() {
+		s.lock.Lock()
+		delete(s.containers, c.ID)
+		delete(s.podNames, c.ID)
+		s.lock.Unlock()
+	}()
+	stats, err := s.provider.ContainerStats(ctx, c.ID)
+	if err != nil {
+		return
+	}
+	defer stats.Body.Close()
+	decoder := json.NewDecoder(stats.Body)
+	for {
+		var statsJSON types.StatsJSON
+		if err := decoder.Decode(&statsJSON); err != nil {
+			return
+		}
+		s.update(c, calculateUsage(&statsJSON))
+	}
+}
+
+func (s *Stats) update(c types.Container, usage common.ResourceUsage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	podName := c.Labels[common.LabelPodName]
+	s.containers[c.ID] = &common.ContainerStats{
+		Name:          c.Labels[common.LabelContainerName],
+		ContainerId:   c.ID,
+		ResourceUsage: usage,
+	}
+	total := s.podUsage(podName)
+	peak, ok := s.peaks[podName]
+	if !ok {
+		peak = &common.ResourceUsage{}
+		s.peaks[podName] = peak
+	}
+	maxUsage(peak, total.ResourceUsage)
+}
+
+// podUsage sums the containers of a pod, containers share the pause network so network io is not summed
+func (s *Stats) podUsage(podName string) common.PodStats {
+	podStats := common.PodStats{
+		Name:           podName,
+		ContainerStats: make([]common.ContainerStats, 0),
+	}
+	for id, containerStats := range s.containers {
+		if s.podNames[id] != podName {
+			continue
+		}
+		usage := containerStats.ResourceUsage
+		podStats.CpuPercent += usage.CpuPercent
+		podStats.MemoryUsage += usage.MemoryUsage
+		podStats.MemoryLimit += usage.MemoryLimit
+		podStats.BlockRead += usage.BlockRead
+		podStats.BlockWrite += usage.BlockWrite
+		if usage.NetworkRx > podStats.NetworkRx {
+			podStats.NetworkRx = usage.NetworkRx
+		}
+		if usage.NetworkTx > podStats.NetworkTx {
+			podStats.NetworkTx = usage.NetworkTx
+		}
+		podStats.ContainerStats = append(podStats.ContainerStats, *containerStats)
+	}
+	return podStats
+}
+
+// GetPodStats returns the current usage of every running pod
+func (s *Stats) GetPodStats() []common.PodStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	podNames := make(map[string]string)
+	for _, podName := range s.podNames {
+		podNames[podName] = podName
+	}
+	result := make([]common.PodStats, 0)
+	for podName := range podNames {
+		result = append(result, s.podUsage(podName))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// GetSummary returns the peak usage of every pod since the stats started
+func (s *Stats) GetSummary() common.StatsSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pods := make([]common.PodStatsSummary, 0)
+	for podName, peak := range s.peaks {
+		pods = append(pods, common.PodStatsSummary{
+			Name: podName,
+			Peak: *peak,
+		})
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	return common.StatsSummary{
+		SessionId: s.sessionId,
+		Pods:      pods,
+	}
+}
+
+// WriteSummary logs the peak usage summary and saves it into dir, e.g. the log volume, it is only logged when dir is empty
+func (s *Stats) WriteSummary(dir string) error {
+	summary, err := json.MarshalIndent(s.GetSummary(), "", "  ")
+	if err != nil {
+		return err
+	}
+	zap.L().Sugar().Infof("stats summary: %s", string(summary))
+	if dir == "" {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(dir, common.StatsSummaryFileName), summary, 0644)
+}
+
+func calculateUsage(stats *types.StatsJSON) common.ResourceUsage {
+	usage := common.ResourceUsage{
+		MemoryUsage: stats.MemoryStats.Usage,
+		MemoryLimit: stats.MemoryStats.Limit,
+	}
+	// same as docker cli, page cache is not counted as used memory
+	if cache, ok := stats.MemoryStats.Stats["inactive_file"]; ok && cache < usage.MemoryUsage {
+		usage.MemoryUsage -= cache
+	} else if cache, ok := stats.MemoryStats.Stats["cache"]; ok && cache < usage.MemoryUsage {
+		usage.MemoryUsage -= cache
+	}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		usage.CpuPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+	for _, network := range stats.Networks {
+		usage.NetworkRx += network.RxBytes
+		usage.NetworkTx += network.TxBytes
+	}
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			usage.BlockRead += entry.Value
+		case "write":
+			usage.BlockWrite += entry.Value
+		}
+	}
+	return usage
+}
+
+func maxUsage(peak *common.ResourceUsage, usage common.ResourceUsage) {
+	if usage.CpuPercent > peak.CpuPercent {
+		peak.CpuPercent = usage.CpuPercent
+	}
+	if usage.MemoryUsage > peak.MemoryUsage {
+		peak.MemoryUsage = usage.MemoryUsage
+	}
+	if usage.MemoryLimit > peak.MemoryLimit {
+		peak.MemoryLimit = usage.MemoryLimit
+	}
+	if usage.NetworkRx > peak.NetworkRx {
+		peak.NetworkRx = usage.NetworkRx
+	}
+	if usage.NetworkTx > peak.NetworkTx {
+		peak.NetworkTx = usage.NetworkTx
+	}
+	if usage.BlockRead > peak.BlockRead {
+		peak.BlockRead = usage.BlockRead
+	}
+	if usage.BlockWrite > peak.BlockWrite {
+		peak.BlockWrite = usage.BlockWrite
+	}
+}
@@ -0,0 +1,93 @@
+package compose
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"podcompose/common"
+	"podcompose/docker/fake"
+	"testing"
+)
+
+func Test_calculateUsage(t *testing.T) {
+	convey.Convey("test calculate usage", t, func() {
+		stats := &types.StatsJSON{
+			Stats: types.Stats{
+				CPUStats: types.CPUStats{
+					CPUUsage:    types.CPUUsage{TotalUsage: 300},
+					SystemUsage: 2000,
+					OnlineCPUs:  2,
+				},
+				PreCPUStats: types.CPUStats{
+					CPUUsage:    types.CPUUsage{TotalUsage: 100},
+					SystemUsage: 1000,
+				},
+				MemoryStats: types.MemoryStats{
+					Usage: 1000,
+					Limit: 4000,
+					Stats: map[string]uint64{"inactive_file": 200},
+				},
+				BlkioStats: types.BlkioStats{
+					IoServiceBytesRecursive: []types.BlkioStatEntry{
+						{Op: "Read", Value: 10},
+						{Op: "write", Value: 20},
+						{Op: "Total", Value: 30},
+					},
+				},
+			},
+			Networks: map[string]types.NetworkStats{
+				"eth0": {RxBytes: 5, TxBytes: 6},
+				"eth1": {RxBytes: 1, TxBytes: 1},
+			},
+		}
+		usage := calculateUsage(stats)
+		convey.So(usage.CpuPercent, convey.ShouldEqual, 40)
+		convey.So(usage.MemoryUsage, convey.ShouldEqual, 800)
+		convey.So(usage.MemoryLimit, convey.ShouldEqual, 4000)
+		convey.So(usage.BlockRead, convey.ShouldEqual, 10)
+		convey.So(usage.BlockWrite, convey.ShouldEqual, 20)
+		convey.So(usage.NetworkRx, convey.ShouldEqual, 6)
+		convey.So(usage.NetworkTx, convey.ShouldEqual, 7)
+	})
+}
+
+func Test_StatsPeak(t *testing.T) {
+	convey.Convey("test pod usage and peak", t, func() {
+		stats := NewStats(nil, "session")
+		app := types.Container{ID: "app", Labels: map[string]string{common.LabelPodName: "demo", common.LabelContainerName: "app"}}
+		proxy := types.Container{ID: "proxy", Labels: map[string]string{common.LabelPodName: "demo", common.LabelContainerName: "proxy"}}
+		stats.podNames[app.ID] = "demo"
+		stats.podNames[proxy.ID] = "demo"
+		stats.update(app, common.ResourceUsage{MemoryUsage: 100, NetworkRx: 50})
+		stats.update(proxy, common.ResourceUsage{MemoryUsage: 20, NetworkRx: 50})
+		stats.update(app, common.ResourceUsage{MemoryUsage: 10, NetworkRx: 60})
+		podStats := stats.GetPodStats()
+		convey.So(len(podStats), convey.ShouldEqual, 1)
+		convey.So(podStats[0].MemoryUsage, convey.ShouldEqual, 30)
+		convey.So(podStats[0].NetworkRx, convey.ShouldEqual, 60)
+		convey.So(len(podStats[0].ContainerStats), convey.ShouldEqual, 2)
+		summary := stats.GetSummary()
+		convey.So(summary.Pods[0].Name, convey.ShouldEqual, "demo")
+		convey.So(summary.Pods[0].Peak.MemoryUsage, convey.ShouldEqual, 120)
+		convey.So(summary.Pods[0].Peak.NetworkRx, convey.ShouldEqual, 60)
+	})
+}
+
+func Test_StatsFinish(t *testing.T) {
+	convey.Convey("test the summary is not written again once the stats are stopped", t, func() {
+		dir := t.TempDir()
+		stats := NewStats(fake.NewRuntime(), "session")
+		stats.Start()
+		convey.So(stats.Finish(dir), convey.ShouldBeNil)
+		info, err := os.Stat(filepath.Join(dir, common.StatsSummaryFileName))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(info.Mode().Perm(), convey.ShouldEqual, os.FileMode(0644))
+		convey.So(os.Remove(filepath.Join(dir, common.StatsSummaryFileName)), convey.ShouldBeNil)
+		convey.So(stats.Finish(dir), convey.ShouldBeNil)
+		_, err = os.Stat(filepath.Join(dir, common.StatsSummaryFileName))
+		convey.So(os.IsNotExist(err), convey.ShouldBeTrue)
+		// in process the host has no log volume to write into
+		convey.So((&Compose{inProcess: true}).logPath(), convey.ShouldBeEmpty)
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/pkg/errors"
 	"os"
 	"path/filepath"
+	"podcompose/docker"
+	"strings"
 )
 
 type ComposeConfig struct {
@@ -16,6 +18,9 @@ type ComposeConfig struct {
 	Pods         []*PodConfig       `json:"pods,omitempty" yaml:"pods,omitempty" validate:"omitempty,dive"`
 	VolumeGroups VolumeGroupConfigs `json:"volumeGroups,omitempty" yaml:"volumeGroups,omitempty" validate:"omitempty,dive"`
 	Volumes      []*VolumeConfig    `json:"volumes,omitempty" yaml:"volumes,omitempty" validate:"omitempty,dive"`
+	EventSinks   []*EventSinkConfig `json:"eventSinks,omitempty" yaml:"eventSinks,omitempty" validate:"omitempty,dive"`
+	// EventFormat set to cloudevents sends the event bus messages as CloudEvents
+	EventFormat string `json:"eventFormat,omitempty" yaml:"eventFormat,omitempty" validate:"omitempty,oneof=cloudevents"`
 }
 type TaskGroups []*TaskGroup
 type TaskGroup struct {
@@ -92,6 +97,12 @@ func (c *ComposeConfig) check(contextPath string) error {
 	}
 	for _, v := range c.Volumes {
 		delete(needVolumeMap, v.Name)
+		if err := v.check(contextPath); err != nil {
+			return err
+		}
+	}
+	if err := c.VolumeGroups.resolveExtends(); err != nil {
+		return err
 	}
 	for _, vg := range c.VolumeGroups {
 		volumeCheck := make(map[string]bool)
@@ -119,6 +130,18 @@ func (c *ComposeConfig) check(contextPath string) error {
 	return nil
 }
 
+// EventSinkConfig is a webhook receiving the matching events as EventMsg json,
+// empty Topics or Types match every event, a type also matches the types suffixed with ":name"
+type EventSinkConfig struct {
+	Url    string   `json:"url" yaml:"url" validate:"required,url"`
+	Topics []string `json:"topics,omitempty" yaml:"topics,omitempty"`
+	Types  []string `json:"types,omitempty" yaml:"types,omitempty"`
+	// Secret signs the body with HMAC-SHA256 in the X-Tpc-Signature header
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// MaxRetries is the number of retries of a failed delivery, 3 when not set, 0 turns the retries off
+	MaxRetries *int `json:"maxRetries,omitempty" yaml:"maxRetries,omitempty" validate:"omitempty,gte=0"`
+}
+
 type VolumeGroupConfigs []*VolumeGroupConfig
 
 func (v VolumeGroupConfigs) GetGroup(name string) (*VolumeGroupConfig, int) {
@@ -134,26 +157,193 @@ func (v VolumeGroupConfigs) GetGroup(name string) (*VolumeGroupConfig, int) {
 	return selectVolumeGroup, selectIndex
 }
 
+// resolveExtends replaces the volumes of the groups extending another group with the volumes of the base group
+// overlaid by their own, an extends chain must end in a group of the config without a cycle
+func (v VolumeGroupConfigs) resolveExtends() error {
+	resolved := make(map[string]bool)
+	var resolve func(volumeGroup *VolumeGroupConfig, chain []string) error
+	resolve = func(volumeGroup *VolumeGroupConfig, chain []string) error {
+		if volumeGroup.Extends == "" || resolved[volumeGroup.Name] {
+			return nil
+		}
+		chain = append(chain, volumeGroup.Name)
+		for _, name := range chain[:len(chain)-1] {
+			if name == volumeGroup.Name {
+				return errors.Errorf("volumeGroup name:%s extends itself through %s", volumeGroup.Name, strings.Join(chain, " -> "))
+			}
+		}
+		base, _ := v.GetGroup(volumeGroup.Extends)
+		if base == nil {
+			return errors.Errorf("volumeGroup name:%s extends %s which is not found", volumeGroup.Name, volumeGroup.Extends)
+		}
+		if err := resolve(base, chain); err != nil {
+			return err
+		}
+		overlays := make(map[string]*VolumeConfig)
+		for _, volume := range volumeGroup.Volumes {
+			overlays[volume.Name] = volume
+		}
+		volumes := make([]*VolumeConfig, 0, len(base.Volumes))
+		for _, baseVolume := range base.Volumes {
+			overlay, ok := overlays[baseVolume.Name]
+			if !ok {
+				volumes = append(volumes, baseVolume)
+				continue
+			}
+			delete(overlays, baseVolume.Name)
+			volumes = append(volumes, overlay.extend(baseVolume))
+		}
+		// the volumes the base does not have are kept for the volume check
+		for _, volume := range volumeGroup.Volumes {
+			if _, ok := overlays[volume.Name]; ok {
+				volumes = append(volumes, volume)
+			}
+		}
+		volumeGroup.Volumes = volumes
+		resolved[volumeGroup.Name] = true
+		return nil
+	}
+	for _, volumeGroup := range v {
+		if err := resolve(volumeGroup, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type VolumeGroupConfig struct {
-	Name    string          `json:"name" yaml:"name" validate:"required"`
+	Name string `json:"name" yaml:"name" validate:"required"`
+	// Extends is the group whose volumes this group overlays, a volume left out is the one of the base group
+	Extends string          `json:"extends,omitempty" yaml:"extends,omitempty"`
 	Volumes []*VolumeConfig `json:"volumes" validate:"omitempty,dive"`
 }
 
 type VolumeConfig struct {
 	Name string `json:"name" yaml:"name" validate:"required"`
+	// Path is a directory or a .tar, .tar.gz, .tgz or .zip file of the context extracted into the volume
 	Path string `json:"path" yaml:"path"`
+	// Owner is the uid:gid of the copied files, root when it is empty
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	// Mode is the octal permission of the copied files, directories get x where r is set, kept when it is empty
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Symlinks is keep, follow or skip, see docker.SymlinkKeep
+	Symlinks string `json:"symlinks,omitempty" yaml:"symlinks,omitempty"`
+	// Cache seeds the volume from a cache volume of the content hash of Path shared by the sessions,
+	// nil is the one of the base volume
+	Cache *bool `json:"cache,omitempty" yaml:"cache,omitempty"`
+	// ReadOnly mounts the volume read only, a cached volume is then the cache volume itself instead of a copy,
+	// nil is the one of the base volume
+	ReadOnly *bool `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+	// layers are the paths of an extended volume, the base first, see extend
+	layers []string
+}
+
+// extend is the volume overlaid on the volume of the base group, its path is seeded after the layers of base
+// and the options it leaves empty are the ones of base
+func (v *VolumeConfig) extend(base *VolumeConfig) *VolumeConfig {
+	extended := *v
+	extended.layers = append(make([]string, 0), base.sources()...)
+	if v.Path != "" {
+		extended.layers = append(extended.layers, v.Path)
+	}
+	if extended.Owner == "" {
+		extended.Owner = base.Owner
+	}
+	if extended.Mode == "" {
+		extended.Mode = base.Mode
+	}
+	if extended.Symlinks == "" {
+		extended.Symlinks = base.Symlinks
+	}
+	if extended.Cache == nil {
+		extended.Cache = base.Cache
+	}
+	if extended.ReadOnly == nil {
+		extended.ReadOnly = base.ReadOnly
+	}
+	return &extended
+}
+
+// extended is true when the volume overlays the volume of a base group, its whiteouts apply, see extend
+func (v *VolumeConfig) extended() bool {
+	return v.layers != nil
+}
+
+func (v *VolumeConfig) cached() bool {
+	return v.Cache != nil && *v.Cache
+}
+
+func (v *VolumeConfig) readOnly() bool {
+	return v.ReadOnly != nil && *v.ReadOnly
+}
+
+// sources are the paths seeded into the volume, the base first, see docker.ArchiveLayers
+func (v *VolumeConfig) sources() []string {
+	if v.layers != nil {
+		return v.layers
+	}
+	if v.Path == "" {
+		return nil
+	}
+	return []string{v.Path}
+}
+
+// sameSource is true when the volume is filled and mounted like other
+func (v *VolumeConfig) sameSource(other *VolumeConfig) bool {
+	sources, otherSources := v.sources(), other.sources()
+	if len(sources) != len(otherSources) {
+		return false
+	}
+	for i := range sources {
+		if sources[i] != otherSources[i] {
+			return false
+		}
+	}
+	return v.Owner == other.Owner && v.Mode == other.Mode && v.Symlinks == other.Symlinks &&
+		v.cached() == other.cached() && v.readOnly() == other.readOnly()
+}
+
+// archiveOptions are the overrides of the copy of Path into the volume
+func (v *VolumeConfig) archiveOptions() (docker.ArchiveOptions, error) {
+	options := docker.ArchiveOptions{Owner: &docker.Owner{}, Symlinks: v.Symlinks}
+	var err error
+	if v.Owner != "" {
+		if options.Owner, err = docker.ParseOwner(v.Owner); err != nil {
+			return options, err
+		}
+	}
+	if v.Mode != "" {
+		if options.Mode, err = docker.ParseMode(v.Mode); err != nil {
+			return options, err
+		}
+	}
+	switch v.Symlinks {
+	case "", docker.SymlinkKeep, docker.SymlinkFollow, docker.SymlinkSkip:
+	default:
+		return options, errors.Errorf("volume %s: invalid symlinks %s, keep, follow or skip expected", v.Name, v.Symlinks)
+	}
+	return options, nil
 }
 
 func (v *VolumeConfig) check(contextPath string) error {
 	if v.Name == "" {
 		return errors.New("volume name must be set")
 	}
-	if v.Path != "" {
-		fileName := filepath.Join(contextPath, v.Path)
-		_, err := os.Stat(fileName)
+	if _, err := v.archiveOptions(); err != nil {
+		return err
+	}
+	for _, source := range v.sources() {
+		fileName := filepath.Join(contextPath, source)
+		info, err := os.Stat(fileName)
 		if err != nil {
 			return err
 		}
+		if !info.IsDir() && !docker.IsArchiveSource(source) {
+			return errors.Errorf("volume %s: path %s must be a directory or a .tar, .tar.gz, .tgz or .zip file", v.Name, source)
+		}
+		if !info.IsDir() && v.Symlinks == docker.SymlinkFollow {
+			return errors.Errorf("volume %s: symlinks of the archive %s can not be followed", v.Name, source)
+		}
 	}
 	return nil
 }
@@ -3,18 +3,38 @@ package compose
 import (
 	"context"
 	"github.com/docker/docker/api/types"
+	"podcompose/common"
 	"podcompose/docker"
+	"sync"
 )
 
 type VolumeGroups struct {
 	volumeGroupConfigs []*VolumeGroupConfig
-	dockerProvider     *docker.DockerProvider
+	dockerProvider     docker.Runtime
+	lock               sync.RWMutex
+	// mounts are what the containers mount by volume name, the session volume when a name is missing
+	mounts map[string]volumeMount
+	// active is the group config of the volume whose data the volume holds, a recreated volume has none until it is seeded,
+	// a volume written by something else than the switch, e.g. a failed seed or a restore, has none either
+	active map[string]activeVolume
 }
 
-func NewVolumeGroups(volumes []*VolumeGroupConfig, dockerProvider *docker.DockerProvider) *VolumeGroups {
+type activeVolume struct {
+	group  string
+	volume *VolumeConfig
+}
+
+type volumeMount struct {
+	source   string
+	readOnly bool
+}
+
+func NewVolumeGroups(volumes []*VolumeGroupConfig, dockerProvider docker.Runtime) *VolumeGroups {
 	return &VolumeGroups{
 		volumeGroupConfigs: volumes,
 		dockerProvider:     dockerProvider,
+		mounts:             make(map[string]volumeMount),
+		active:             make(map[string]activeVolume),
 	}
 }
 func (v *VolumeGroups) createVolume(ctx context.Context, sessionId string, volumeName string) (types.Volume, error) {
@@ -22,34 +42,139 @@ func (v *VolumeGroups) createVolume(ctx context.Context, sessionId string, volum
 }
 func (v *VolumeGroups) createVolumes(ctx context.Context, sessionId string, volumes []*VolumeConfig) error {
 	for _, volume := range volumes {
-		_, err := v.dockerProvider.CreateVolume(ctx, volume.Name, sessionId, "")
+		created, err := v.dockerProvider.CreateVolume(ctx, volume.Name, sessionId, "")
 		if err != nil {
 			return err
 		}
+		v.setMount(volume, created.Name)
 	}
 	return nil
 }
 
 func (v *VolumeGroups) createVolumesWithGroup(ctx context.Context, sessionId string, volumeGroup *VolumeGroupConfig) error {
 	for _, volume := range volumeGroup.Volumes {
-		_, err := v.dockerProvider.CreateVolume(ctx, volume.Name, sessionId, volumeGroup.Name)
+		created, err := v.dockerProvider.CreateVolume(ctx, volume.Name, sessionId, volumeGroup.Name)
 		if err != nil {
 			return err
 		}
+		v.setMount(volume, created.Name)
 	}
+	v.activate(volumeGroup)
 	return nil
 }
 
-func (v *VolumeGroups) recreateVolumesWithGroup(ctx context.Context, volumeGroup *VolumeGroupConfig, sessionId string) error {
-	for _, volume := range volumeGroup.Volumes {
+// recreateVolumesWithGroup recreates the volumes of the group empty, they are not active until activate
+func (v *VolumeGroups) recreateVolumesWithGroup(ctx context.Context, volumeGroup *VolumeGroupConfig, volumes []*VolumeConfig, sessionId string) error {
+	for _, volume := range volumes {
+		v.deactivate(volume.Name)
 		err := v.dockerProvider.RemoveVolume(ctx, volume.Name, sessionId, true)
 		if err != nil {
 			return err
 		}
-		_, err = v.dockerProvider.CreateVolume(ctx, volume.Name, sessionId, volumeGroup.Name)
+		created, err := v.dockerProvider.CreateVolume(ctx, volume.Name, sessionId, volumeGroup.Name)
 		if err != nil {
 			return err
 		}
+		v.setMount(volume, created.Name)
 	}
 	return nil
 }
+
+func (v *VolumeGroups) setMount(volume *VolumeConfig, source string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.mounts[volume.Name] = volumeMount{source: source, readOnly: volume.readOnly()}
+}
+
+// setSource makes the containers mount source instead of the session volume of the name, e.g. a cache volume
+func (v *VolumeGroups) setSource(name string, source string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	mount := v.mounts[name]
+	mount.source = source
+	v.mounts[name] = mount
+}
+
+// sources are the volumes the containers mount instead of the session volume by volume name
+func (v *VolumeGroups) sources(sessionId string) map[string]string {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	sources := make(map[string]string)
+	for name, mount := range v.mounts {
+		if mount.source != "" && mount.source != name+"_"+sessionId {
+			sources[name] = mount.source
+		}
+	}
+	return sources
+}
+
+func (v *VolumeGroups) isReadOnly(name string) bool {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.mounts[name].readOnly
+}
+
+func (v *VolumeGroups) containerMount(sessionId string, name string, target docker.ContainerMountTarget) docker.ContainerMount {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	mount, ok := v.mounts[name]
+	if !ok || mount.source == "" {
+		return docker.VolumeMount(name+"_"+sessionId, target)
+	}
+	containerMount := docker.VolumeMount(mount.source, target)
+	containerMount.ReadOnly = mount.readOnly
+	return containerMount
+}
+
+// activate records the volumes of the group hold its data
+func (v *VolumeGroups) activate(volumeGroup *VolumeGroupConfig) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	for _, volume := range volumeGroup.Volumes {
+		v.active[volume.Name] = activeVolume{group: volumeGroup.Name, volume: volume}
+	}
+}
+
+// deactivate records the volume of the name holds the data of no group, e.g. while it is restored from a snapshot
+func (v *VolumeGroups) deactivate(name string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	delete(v.active, name)
+}
+
+// changedVolumes are the volumes of the group whose source differs from the active one, or that are not active
+func (v *VolumeGroups) changedVolumes(volumeGroup *VolumeGroupConfig) []*VolumeConfig {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	changed := make([]*VolumeConfig, 0)
+	for _, volume := range volumeGroup.Volumes {
+		active, ok := v.active[volume.Name]
+		if !ok || !active.volume.sameSource(volume) {
+			changed = append(changed, volume)
+		}
+	}
+	return changed
+}
+
+// volumeInfos are the volumes of the volume groups with the group they hold and the volume mounted by the containers
+func (v *VolumeGroups) volumeInfos(sessionId string) []common.VolumeInfo {
+	if len(v.volumeGroupConfigs) == 0 {
+		return nil
+	}
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	volumes := v.volumeGroupConfigs[0].Volumes
+	volumeInfos := make([]common.VolumeInfo, len(volumes))
+	for i, volume := range volumes {
+		volumeId := v.mounts[volume.Name].source
+		if volumeId == "" {
+			volumeId = volume.Name + "_" + sessionId
+		}
+		volumeInfos[i] = common.VolumeInfo{
+			Name:        volume.Name,
+			VolumeId:    volumeId,
+			VolumeGroup: v.active[volume.Name].group,
+		}
+	}
+	return volumeInfos
+}
@@ -8,7 +8,8 @@ import (
 var ComposeConfig Config
 
 type Config struct {
-	Image Image `json:"image" yaml:"image"`
+	Image   Image   `json:"image" yaml:"image"`
+	Runtime Runtime `json:"runtime" yaml:"runtime"`
 }
 type Image struct {
 	Agent   string `json:"agent" yaml:"agent"`
@@ -16,6 +17,12 @@ type Image struct {
 	Pause   string `json:"pause" yaml:"pause"`
 }
 
+// Runtime selects the container engine, DOCKER_HOST takes precedence over it
+type Runtime struct {
+	// Host of the engine api, e.g. unix:///run/user/1000/podman/podman.sock, a plain path is a unix socket
+	Host string `json:"host" yaml:"host"`
+}
+
 func init() {
 	ComposeConfig.Image = Image{
 		Agent:   "testmesh/compose-agent",
@@ -40,6 +47,9 @@ func SetConfigJson(configJson string) error {
 	if composeConfig.Image.Agent != "" {
 		ComposeConfig.Image.Agent = composeConfig.Image.Agent
 	}
+	if composeConfig.Runtime.Host != "" {
+		ComposeConfig.Runtime.Host = composeConfig.Runtime.Host
+	}
 	return nil
 }
 
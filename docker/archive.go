@@ -0,0 +1,291 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SymlinkKeep   = "keep"   // symlinks are archived as links, the default
+	SymlinkFollow = "follow" // symlinks are archived as the files and directories they point to
+	SymlinkSkip   = "skip"   // symlinks are left out
+)
+
+// IgnoreFileName lists the paths ArchiveDirWithOptions leaves out, one filepath.Match pattern per line matched
+// against the path in the archive and against the base name, a trailing slash only matches directories
+// and lines starting with # are comments
+const IgnoreFileName = ".tpcignore"
+
+// Owner is the uid and gid of the archived entries
+type Owner struct {
+	Uid int
+	Gid int
+}
+
+// ParseOwner parses uid:gid, the gid is the uid when it is left out
+func ParseOwner(owner string) (*Owner, error) {
+	uid, gid, found := strings.Cut(owner, ":")
+	if !found {
+		gid = uid
+	}
+	u, err := strconv.Atoi(uid)
+	if err != nil || u < 0 {
+		return nil, errors.Errorf("invalid owner %s, uid:gid expected", owner)
+	}
+	g, err := strconv.Atoi(gid)
+	if err != nil || g < 0 {
+		return nil, errors.Errorf("invalid owner %s, uid:gid expected", owner)
+	}
+	return &Owner{Uid: u, Gid: g}, nil
+}
+
+// ParseMode parses an octal permission like 0644
+func ParseMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, errors.Errorf("invalid mode %s, octal permission expected", mode)
+	}
+	return os.FileMode(m), nil
+}
+
+// ArchiveOptions changes what ArchiveDirWithOptions writes, the zero value keeps the files as they are
+type ArchiveOptions struct {
+	// Owner owns every entry when it is set
+	Owner *Owner
+	// Mode is the permission of the files when it is set, directories get it with x where r is set
+	Mode os.FileMode
+	// Symlinks is one of SymlinkKeep, SymlinkFollow and SymlinkSkip
+	Symlinks string
+	// Progress is called after each file with the files and bytes archived so far
+	Progress func(files int, bytes int64)
+}
+
+// ArchiveDir streams the files under dir as a tar archive, paths are relative to dir and symlinks are kept as links
+func ArchiveDir(dir string) io.ReadCloser {
+	return ArchiveDirWithOptions(dir, ArchiveOptions{})
+}
+
+// ArchiveDirWithOptions is ArchiveDir with the overrides of options, the paths of the .tpcignore file of dir are left out
+func ArchiveDirWithOptions(dir string, options ArchiveOptions) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeArchive(writer, dir, options, false))
+	}()
+	return reader
+}
+
+// ArchiveFile returns a tar archive of a single file
+func ArchiveFile(name string, content []byte, mode int64) io.Reader {
+	buffer := &bytes.Buffer{}
+	tw := tar.NewWriter(buffer)
+	_ = tw.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(content))})
+	_, _ = tw.Write(content)
+	_ = tw.Close()
+	return buffer
+}
+
+type archiver struct {
+	tw      *tar.Writer
+	options ArchiveOptions
+	ignore  []string
+	files   int
+	bytes   int64
+	// visited are the directories being walked, a followed symlink to one of them is a loop
+	visited map[string]bool
+	// normalize leaves out the times and user names so the archive only depends on the content
+	normalize bool
+}
+
+func writeArchive(w io.Writer, dir string, options ArchiveOptions, normalize bool) error {
+	ignore, err := readIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	a := &archiver{
+		tw:        tar.NewWriter(w),
+		options:   options,
+		ignore:    ignore,
+		visited:   map[string]bool{root: true},
+		normalize: normalize,
+	}
+	if err = a.walk(dir, ""); err != nil {
+		return err
+	}
+	return a.tw.Close()
+}
+
+func readIgnoreFile(ignoreFile string) ([]string, error) {
+	file, err := os.Open(ignoreFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	patterns := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err = path.Match(strings.TrimSuffix(line, "/"), ""); err != nil {
+			return nil, errors.Wrapf(err, "pattern %s of %s", line, ignoreFile)
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+func (a *archiver) ignored(name string, isDir bool) bool {
+	if name == IgnoreFileName {
+		return true
+	}
+	for _, pattern := range a.ignore {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walk archives the tree under dir with prefix as its path in the archive
+func (a *archiver) walk(dir string, prefix string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		if a.ignored(name, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return a.symlink(p, name)
+		}
+		return a.write(p, name, info, "")
+	})
+}
+
+func (a *archiver) symlink(p string, name string) error {
+	switch a.options.Symlinks {
+	case SymlinkSkip:
+		return nil
+	case SymlinkFollow:
+		target, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return a.write(target, name, info, "")
+		}
+		if a.visited[target] {
+			return errors.Errorf("symlink %s loops to %s", p, target)
+		}
+		if err = a.write(target, name, info, ""); err != nil {
+			return err
+		}
+		a.visited[target] = true
+		defer delete(a.visited, target)
+		return a.walk(target, name)
+	default:
+		link, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		return a.write(p, name, info, link)
+	}
+}
+
+func (a *archiver) write(p string, name string, info os.FileInfo, link string) error {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if !info.Mode().IsRegular() {
+		return a.add(hdr, nil)
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return a.add(hdr, file)
+}
+
+// add writes the entry with the overrides of the options, content is read for regular files
+func (a *archiver) add(hdr *tar.Header, content io.Reader) error {
+	if a.options.Owner != nil {
+		hdr.Uid, hdr.Gid = a.options.Owner.Uid, a.options.Owner.Gid
+		hdr.Uname, hdr.Gname = "", ""
+	}
+	if a.normalize {
+		hdr.ModTime = time.Unix(0, 0)
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+		hdr.Uname, hdr.Gname = "", ""
+	}
+	if a.options.Mode != 0 && hdr.Typeflag != tar.TypeSymlink {
+		mode := a.options.Mode
+		if hdr.Typeflag == tar.TypeDir {
+			mode |= (mode & 0444) >> 2
+		}
+		hdr.Mode = int64(mode.Perm())
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+	n, err := io.Copy(a.tw, content)
+	if err != nil {
+		return err
+	}
+	a.files++
+	a.bytes += n
+	if a.options.Progress != nil {
+		a.options.Progress(a.files, a.bytes)
+	}
+	return nil
+}
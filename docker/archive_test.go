@@ -0,0 +1,197 @@
+package docker
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiveDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data", "init.sql"), []byte("select 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("data/init.sql", filepath.Join(dir, "init.sql")); err != nil {
+		t.Fatal(err)
+	}
+	archive := ArchiveDir(dir)
+	defer archive.Close()
+	entries := make(map[string]*tar.Header)
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[hdr.Name] = hdr
+		if hdr.Name == "data/init.sql" {
+			content, _ := io.ReadAll(tr)
+			if string(content) != "select 1" {
+				t.Fatalf("unexpected content: %s", content)
+			}
+		}
+	}
+	if len(entries) != 3 || entries["data/"] == nil || entries["data/init.sql"] == nil {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if link := entries["init.sql"]; link == nil || link.Typeflag != tar.TypeSymlink || link.Linkname != "data/init.sql" {
+		t.Fatalf("symlink should be kept: %+v", link)
+	}
+}
+
+// readArchive returns the headers and the file contents of the archive by name
+func readArchive(t *testing.T, archive io.ReadCloser) (map[string]*tar.Header, map[string]string) {
+	defer archive.Close()
+	headers := make(map[string]*tar.Header)
+	contents := make(map[string]string)
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return headers, contents
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[hdr.Name] = hdr
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[hdr.Name] = string(content)
+	}
+}
+
+func TestArchiveDirWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	shared := t.TempDir()
+	for name, content := range map[string]string{
+		"data/init.sql":  "select 1",
+		"data/debug.log": "debug",
+		"logs/app.txt":   "app",
+		"build/logs":     "not a directory",
+		IgnoreFileName:   "# comments are skipped\n*.log\nlogs/\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(shared, "shared.conf"), []byte("shared"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(shared, filepath.Join(dir, "shared")); err != nil {
+		t.Fatal(err)
+	}
+
+	var progressFiles int
+	var progressBytes int64
+	headers, contents := readArchive(t, ArchiveDirWithOptions(dir, ArchiveOptions{
+		Owner:    &Owner{Uid: 999, Gid: 998},
+		Mode:     0640,
+		Symlinks: SymlinkFollow,
+		Progress: func(files int, bytes int64) {
+			progressFiles, progressBytes = files, bytes
+		},
+	}))
+	for _, name := range []string{IgnoreFileName, "data/debug.log", "logs/", "logs/app.txt"} {
+		if _, ok := headers[name]; ok {
+			t.Fatalf("%s should be ignored", name)
+		}
+	}
+	if contents["build/logs"] != "not a directory" {
+		t.Fatal("a directory pattern should not ignore files")
+	}
+	if contents["shared/shared.conf"] != "shared" || headers["shared/"].Typeflag != tar.TypeDir {
+		t.Fatalf("followed symlink should be archived as its directory: %v", headers["shared/"])
+	}
+	sql := headers["data/init.sql"]
+	if sql.Uid != 999 || sql.Gid != 998 || sql.Mode != 0640 {
+		t.Fatalf("owner and mode should be overridden: %d:%d %o", sql.Uid, sql.Gid, sql.Mode)
+	}
+	if mode := headers["data/"].Mode; mode != 0750 {
+		t.Fatalf("directories should be searchable where readable: %o", mode)
+	}
+	if progressFiles != 3 || progressBytes != int64(len("select 1")+len("not a directory")+len("shared")) {
+		t.Fatalf("unexpected progress: %d files %d bytes", progressFiles, progressBytes)
+	}
+
+	headers, _ = readArchive(t, ArchiveDirWithOptions(dir, ArchiveOptions{Symlinks: SymlinkSkip}))
+	if _, ok := headers["shared"]; ok {
+		t.Fatal("symlink should be skipped")
+	}
+
+	if err := os.Symlink(dir, filepath.Join(dir, "data", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	archive := ArchiveDirWithOptions(dir, ArchiveOptions{Symlinks: SymlinkFollow})
+	defer archive.Close()
+	if _, err := io.Copy(io.Discard, archive); err == nil {
+		t.Fatal("symlink loop should fail the archive")
+	}
+}
+
+func TestParseOwnerAndMode(t *testing.T) {
+	if owner, err := ParseOwner("999"); err != nil || owner.Uid != 999 || owner.Gid != 999 {
+		t.Fatalf("unexpected owner: %+v %v", owner, err)
+	}
+	if owner, err := ParseOwner("1000:50"); err != nil || owner.Uid != 1000 || owner.Gid != 50 {
+		t.Fatalf("unexpected owner: %+v %v", owner, err)
+	}
+	if _, err := ParseOwner("mysql"); err == nil {
+		t.Fatal("names are not supported")
+	}
+	if mode, err := ParseMode("0644"); err != nil || mode != 0644 {
+		t.Fatalf("unexpected mode: %o %v", mode, err)
+	}
+	if _, err := ParseMode("0999"); err == nil {
+		t.Fatal("mode should be octal")
+	}
+}
+
+func TestHashSource(t *testing.T) {
+	hash := func(dir string, options ArchiveOptions) string {
+		h, err := HashSource(dir, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	root := &Owner{}
+	a, b := t.TempDir(), t.TempDir()
+	for _, dir := range []string{a, b} {
+		if err := os.MkdirAll(filepath.Join(dir, "sql"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "sql", "init.sql"), []byte("select 1;"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(b, "sql", "init.sql"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if hash(a, ArchiveOptions{Owner: root}) != hash(b, ArchiveOptions{Owner: root}) {
+		t.Fatal("the modification time should not change the hash")
+	}
+	if hash(a, ArchiveOptions{Owner: root}) == hash(a, ArchiveOptions{Owner: root, Mode: 0600}) {
+		t.Fatal("the options should change the hash")
+	}
+	if err := os.WriteFile(filepath.Join(b, "sql", "init.sql"), []byte("select 2;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if hash(a, ArchiveOptions{Owner: root}) == hash(b, ArchiveOptions{Owner: root}) {
+		t.Fatal("the content should change the hash")
+	}
+}
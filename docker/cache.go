@@ -0,0 +1,145 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+	"io"
+	"podcompose/common"
+	"strings"
+)
+
+const (
+	// CacheVolumeLabel marks the cache volumes, they hold the seeded data of a volume source by its content hash
+	// and outlive the sessions, so they have no session label and are only removed by tpc cache prune
+	CacheVolumeLabel = "tpc.cache"
+	CacheHashLabel   = "tpc.cache.hash"
+	// CacheSourceLabel is the path of the source in the context that filled the cache volume
+	CacheSourceLabel = "tpc.cache.source"
+	// CacheCompleteLabel is the cache volume a marker volume records as filled, volume labels can not change
+	// so the marker is an empty volume created after the copy and FindCacheVolume only returns marked caches
+	CacheCompleteLabel  = "tpc.cache.complete"
+	cacheVolumePrefix   = common.ContainerNamePrefix + "cache_"
+	cacheCompleteSuffix = "_complete"
+)
+
+// CacheVolumeName is the name of the cache volume of the content hash filled by the session, every session
+// fills its own so a failed fill never touches a cache another session uses
+func CacheVolumeName(hash string, sessionId string) string {
+	return cacheVolumePrefix + hash + "_" + sessionId
+}
+
+// IsCacheVolume is true when the volume name is the one of a cache volume, see CacheVolumeName
+func IsCacheVolume(volumeName string) bool {
+	return strings.HasPrefix(volumeName, cacheVolumePrefix)
+}
+
+// HashSource is the sha256 of what ArchiveSource writes for src without the modification times,
+// so the same files with the same options have the same hash wherever they are checked out
+func HashSource(src string, options ArchiveOptions) (string, error) {
+	hash := sha256.New()
+	options.Progress = nil
+	if err := writeSource(hash, src, options, true); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// FindCacheVolume returns a filled cache volume of the content hash, nil when there is none
+func (p *DockerProvider) FindCacheVolume(ctx context.Context, hash string) (*types.Volume, error) {
+	filtersJSON := fmt.Sprintf(`{"label":{"%s=%s":true,"%s":true}}`, CacheHashLabel, hash, CacheCompleteLabel)
+	fj, _ := filters.FromJSON(filtersJSON)
+	volumeListOKBody, err := p.client.VolumeList(ctx, fj)
+	if err != nil {
+		return nil, err
+	}
+	for _, marker := range volumeListOKBody.Volumes {
+		v, err := p.client.VolumeInspect(ctx, marker.Labels[CacheCompleteLabel])
+		if client.IsErrNotFound(err) {
+			// the cache was pruned
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &v, nil
+	}
+	return nil, nil
+}
+
+// CreateCacheVolume creates the cache volume of the content hash for the session and extracts the archive into it,
+// it is only found by FindCacheVolume once the copy succeeded and it is removed when the copy fails
+func (p *DockerProvider) CreateCacheVolume(ctx context.Context, hash string, source string, sessionId string, archive io.Reader) (types.Volume, error) {
+	v, err := p.client.VolumeCreate(ctx, volume.VolumeCreateBody{
+		Driver: "local",
+		Name:   CacheVolumeName(hash, sessionId),
+		Labels: map[string]string{
+			CacheVolumeLabel: "true",
+			CacheHashLabel:   hash,
+			CacheSourceLabel: source,
+		},
+	})
+	if err != nil {
+		return v, err
+	}
+	err = p.copyToVolume(ctx, v.Name, common.ContainerNamePrefix+"copy_"+v.Name, sessionId, archive)
+	if err == nil {
+		_, err = p.client.VolumeCreate(ctx, volume.VolumeCreateBody{
+			Driver: "local",
+			Name:   v.Name + cacheCompleteSuffix,
+			Labels: map[string]string{
+				CacheHashLabel:     hash,
+				CacheCompleteLabel: v.Name,
+			},
+		})
+	}
+	if err != nil {
+		if removeErr := p.client.VolumeRemove(context.Background(), v.Name, true); removeErr != nil {
+			zap.L().Sugar().Error(removeErr)
+		}
+		return v, err
+	}
+	return v, nil
+}
+
+func (p *DockerProvider) FindAllCacheVolumes(ctx context.Context) ([]*types.Volume, error) {
+	filtersJSON := fmt.Sprintf(`{"label":{"%s":true}}`, CacheVolumeLabel)
+	fj, _ := filters.FromJSON(filtersJSON)
+	volumeListOKBody, err := p.client.VolumeList(ctx, fj)
+	if err != nil {
+		return nil, err
+	}
+	return volumeListOKBody.Volumes, nil
+}
+
+// RemoveCacheVolume removes the cache volume and its marker, it fails when a container still mounts it
+func (p *DockerProvider) RemoveCacheVolume(ctx context.Context, name string) error {
+	zap.L().Sugar().Debugf("remove cache volume : %s", name)
+	if err := p.client.VolumeRemove(ctx, name, false); err != nil {
+		return err
+	}
+	if err := p.client.VolumeRemove(ctx, name+cacheCompleteSuffix, false); err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// CloneVolume copies the files of the from volume into the volume of the session through the archive api,
+// so it also works when the engine is on another machine
+func (p *DockerProvider) CloneVolume(ctx context.Context, from string, volumeName string, sessionId string) error {
+	if !strings.HasSuffix(volumeName, sessionId) {
+		volumeName = volumeName + "_" + sessionId
+	}
+	archive, err := p.exportVolume(ctx, from, common.ContainerNamePrefix+"clone_"+volumeName, sessionId)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	return p.copyToVolume(ctx, volumeName, common.ContainerNamePrefix+"copy_"+volumeName, sessionId, archive)
+}
@@ -35,6 +35,7 @@ type ContainerRequest struct {
 	DNS             []string
 	CapAdd          strslice.StrSlice // List of kernel capabilities to add to the container
 	CapDrop         strslice.StrSlice // List of kernel capabilities to remove from the container
+	SecurityOpt     []string          // e.g. label=disable to use the engine socket with selinux
 	User            string            // for specifying uid:gid
 	AutoRemove      bool              // if set to true, the container will be removed from the host when stopped
 	AlwaysPullImage bool              // Always pull image
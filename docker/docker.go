@@ -10,6 +10,7 @@ import (
 	"github.com/containerd/containerd/platforms"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
@@ -21,13 +22,17 @@ import (
 	"go.uber.org/zap"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"podcompose/common"
+	"podcompose/config"
 	"podcompose/docker/wait"
 	"podcompose/event"
+	"podcompose/metrics"
+	"podcompose/trace"
 	"strings"
 	"time"
 )
@@ -46,6 +51,9 @@ const (
 	AgentTypeIngressVolume = "ingressVolume"
 	AgentTypeIngress       = "ingress"
 	AgentTypeSwitchData    = "switchData"
+	volumeCopyPath         = "/volume"
+	// volumeHelperRemoveTimeout bounds the removal of a volume helper container after its copy or export
+	volumeHelperRemoveTimeout = 30 * time.Second
 )
 
 var (
@@ -58,11 +66,24 @@ type DockerProvider struct {
 	client         *client.Client
 	hostCache      string
 	defaultNetwork string // default container network
+	capabilities   Capabilities
 }
 
-// NewDockerProvider creates a Docker provider with the EnvClient
+// NewDockerProvider creates a Docker provider with the EnvClient, the engine is taken from DOCKER_HOST
+// or the runtime host of the config, so rootless docker and podman sockets work too
 func NewDockerProvider() (*DockerProvider, error) {
 	opts := []client.Opt{client.FromEnv}
+	host := runtimeHost()
+	if strings.HasPrefix(host, "ssh://") {
+		dialer, err := sshDialer(host)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithHTTPClient(&http.Client{Transport: &http.Transport{DialContext: dialer}}),
+			client.WithHost(sshClientHost), client.WithDialContext(dialer))
+	} else if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
 	c, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil, err
@@ -76,6 +97,19 @@ func NewDockerProvider() (*DockerProvider, error) {
 	p := &DockerProvider{
 		client: c,
 	}
+	if host == "" {
+		host = c.DaemonHost()
+	}
+	p.capabilities, err = probe(ctx, c, host)
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Sugar().Debugf("container engine: %s %s, api: %s, rootless: %t, remote: %t, host: %s", p.capabilities.Engine,
+		p.capabilities.Version, p.capabilities.ApiVersion, p.capabilities.Rootless, p.capabilities.Remote, p.capabilities.Host)
+	if p.capabilities.IsPodman() {
+		p.defaultNetwork = PodmanNetwork
+		return p, nil
+	}
 	err = p.setDefaultNetwork(ctx)
 	if err != nil {
 		return nil, err
@@ -83,6 +117,11 @@ func NewDockerProvider() (*DockerProvider, error) {
 	return p, nil
 }
 
+// Capabilities returns what the probe found out about the engine
+func (p *DockerProvider) Capabilities() Capabilities {
+	return p.capabilities
+}
+
 func (p *DockerProvider) GetClient() *client.Client {
 	return p.client
 }
@@ -106,8 +145,12 @@ func (p *DockerProvider) CreateContainerAutoLabel(ctx context.Context, req Conta
 }
 
 // CreateContainer fulfills a request for a container without starting it
-func (p *DockerProvider) CreateContainer(ctx context.Context, req ContainerRequest, sessionId string, autoLabel bool) (Container, error) {
-	var err error
+func (p *DockerProvider) CreateContainer(ctx context.Context, req ContainerRequest, sessionId string, autoLabel bool) (_ Container, err error) {
+	ctx, span := trace.Start(ctx, "create_container")
+	span.SetAttribute("container.name", req.Name).SetAttribute("container.image", req.Image)
+	defer func() {
+		span.Finish(err)
+	}()
 	if req.Labels == nil {
 		req.Labels = make(map[string]string)
 	}
@@ -176,7 +219,7 @@ func (p *DockerProvider) CreateContainer(ctx context.Context, req ContainerReque
 			pullOpt.RegistryAuth = req.RegistryCred
 		}
 
-		event.Publish(&event.ContainerEventData{
+		event.Publish(ctx, &event.ContainerEventData{
 			PodName:       req.Labels[common.LabelPodName],
 			ContainerName: req.Labels[common.LabelContainerName],
 			Type:          event.ContainerEventPullStartType,
@@ -185,8 +228,13 @@ func (p *DockerProvider) CreateContainer(ctx context.Context, req ContainerReque
 			Image:         req.Image,
 		})
 
-		if err := p.attemptToPullImage(ctx, tag, pullOpt); err != nil {
-			event.Publish(&event.ContainerEventData{
+		pullStart := time.Now()
+		_, pullSpan := trace.Start(ctx, "pull_image")
+		err := p.attemptToPullImage(ctx, tag, pullOpt)
+		pullSpan.SetAttribute("container.image", tag).Finish(err)
+		metrics.ImagePullDuration.WithLabelValues(tag, metrics.Result(err)).Observe(time.Since(pullStart).Seconds())
+		if err != nil {
+			event.Publish(ctx, &event.ContainerEventData{
 				PodName:       req.Labels[common.LabelPodName],
 				ContainerName: req.Labels[common.LabelContainerName],
 				Type:          event.ContainerEventPullFailType,
@@ -197,7 +245,7 @@ func (p *DockerProvider) CreateContainer(ctx context.Context, req ContainerReque
 			return nil, err
 		}
 
-		event.Publish(&event.ContainerEventData{
+		event.Publish(ctx, &event.ContainerEventData{
 			PodName:       req.Labels[common.LabelPodName],
 			ContainerName: req.Labels[common.LabelContainerName],
 			Type:          event.ContainerEventPullSuccessType,
@@ -233,6 +281,7 @@ func (p *DockerProvider) CreateContainer(ctx context.Context, req ContainerReque
 		DNS:          req.DNS,
 		CapAdd:       req.CapAdd,
 		CapDrop:      req.CapDrop,
+		SecurityOpt:  req.SecurityOpt,
 	}
 
 	endpointConfigs := map[string]*network.EndpointSettings{}
@@ -292,7 +341,7 @@ func (p *DockerProvider) CreateContainer(ctx context.Context, req ContainerReque
 		stopProducer:      make(chan bool),
 		logger:            Logger,
 	}
-	event.Publish(&event.ContainerEventData{
+	event.Publish(ctx, &event.ContainerEventData{
 		PodName:       req.Labels[common.LabelPodName],
 		ContainerName: req.Labels[common.LabelContainerName],
 		Type:          event.ContainerEventCreatedType,
@@ -351,28 +400,21 @@ func (p *DockerProvider) RunContainer(ctx context.Context, req ContainerRequest,
 	return c, nil
 }
 
-// daemonHost gets the host or ip of the Docker daemon where ports are exposed on
-// Warning: this is based on your Docker host setting. Will fail if using an SSH tunnel
-// You can use the "Host" env variable to set this yourself
+// daemonHost gets the host or ip of the Docker daemon where ports are exposed on,
+// for an ssh host it is the machine the tunnel goes to
 func (p *DockerProvider) daemonHost(ctx context.Context) (string, error) {
 	if p.hostCache != "" {
 		return p.hostCache, nil
 	}
 
-	host, exists := os.LookupEnv(Host)
-	if exists {
-		p.hostCache = host
-		return p.hostCache, nil
-	}
-
-	// infer from Docker host
-	urlParse, err := url.Parse(p.client.DaemonHost())
+	// infer from the probed host, the client only knows a dummy address when tunneling through ssh
+	urlParse, err := url.Parse(p.capabilities.Host)
 	if err != nil {
 		return "", err
 	}
 
 	switch urlParse.Scheme {
-	case "http", "https", "tcp":
+	case "http", "https", "tcp", "ssh":
 		p.hostCache = urlParse.Hostname()
 	case "unix", "npipe":
 		if inAContainer() {
@@ -489,6 +531,45 @@ func (p *DockerProvider) RemoveVolume(ctx context.Context, volumeName string, se
 	return p.client.VolumeRemove(ctx, volumeName, force)
 }
 
+// CopyToVolume extracts a tar archive into the volume through a helper container that is never started,
+// so it also works when the engine is on another machine
+func (p *DockerProvider) CopyToVolume(ctx context.Context, volumeName string, sessionId string, archive io.Reader) error {
+	if !strings.HasSuffix(volumeName, sessionId) {
+		volumeName = volumeName + "_" + sessionId
+	}
+	return p.copyToVolume(ctx, volumeName, common.ContainerNamePrefix+"copy_"+volumeName, sessionId, archive)
+}
+
+// copyToVolume extracts the archive into the volume of the full name through the helper container of the name
+func (p *DockerProvider) copyToVolume(ctx context.Context, volumeName string, helperName string, sessionId string, archive io.Reader) error {
+	c, err := p.createVolumeHelper(ctx, volumeName, helperName, sessionId)
+	if err != nil {
+		return err
+	}
+	defer p.removeVolumeHelper(c.GetContainerID())
+	zap.L().Sugar().Debugf("copy to volume : %s", volumeName)
+	return p.client.CopyToContainer(ctx, c.GetContainerID(), volumeCopyPath, archive, types.CopyToContainerOptions{})
+}
+
+// removeVolumeHelper removes the helper container with a context of its own, so a canceled copy or export
+// does not leave a helper whose name blocks the next one
+func (p *DockerProvider) removeVolumeHelper(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), volumeHelperRemoveTimeout)
+	defer cancel()
+	if err := p.RemoveContainer(ctx, id); err != nil {
+		zap.L().Sugar().Warnf("remove volume helper %s: %v", id, err)
+	}
+}
+
+// createVolumeHelper creates a container mounting the volume at volumeCopyPath, it is never started
+func (p *DockerProvider) createVolumeHelper(ctx context.Context, volumeName string, helperName string, sessionId string) (Container, error) {
+	return p.CreateContainer(ctx, ContainerRequest{
+		Image:  config.ComposeConfig.Image.Pause,
+		Name:   helperName,
+		Mounts: Mounts(VolumeMount(volumeName, volumeCopyPath)),
+	}, sessionId, true)
+}
+
 func (p *DockerProvider) RemoveNetwork(ctx context.Context, networkID string) error {
 	zap.L().Sugar().Debugf("remove network : %s", networkID)
 	return p.client.NetworkRemove(ctx, networkID)
@@ -558,7 +639,7 @@ func (p *DockerProvider) RemoveContainer(ctx context.Context, id string) error {
 	zap.L().Sugar().Debugf("remove container : %s", id)
 	inspect, err := p.ContainerInspect(ctx, id)
 	if err == nil {
-		event.Publish(&event.ContainerEventData{
+		event.Publish(ctx, &event.ContainerEventData{
 			PodName:       inspect.Config.Labels[common.LabelPodName],
 			ContainerName: inspect.Config.Labels[common.LabelContainerName],
 			Type:          event.ContainerEventRemoveType,
@@ -679,6 +760,27 @@ func (p *DockerProvider) ContainerInspect(ctx context.Context, id string) (types
 	return p.GetClient().ContainerInspect(ctx, id)
 }
 
+// ContainerStats streams the resource usage of a container, the body is a sequence of types.StatsJSON
+func (p *DockerProvider) ContainerStats(ctx context.Context, id string) (types.ContainerStats, error) {
+	return p.client.ContainerStats(ctx, id, true)
+}
+
+// ContainerEvents subscribes to the docker events stream for the containers of a session,
+// since is a unix timestamp and may be empty to only receive new events
+func (p *DockerProvider) ContainerEvents(ctx context.Context, sessionId string, since string, actions ...string) (<-chan events.Message, <-chan error) {
+	args := filters.NewArgs(
+		filters.Arg("type", events.ContainerEventType),
+		filters.Arg("label", ComposeSessionID+"="+sessionId),
+	)
+	for _, action := range actions {
+		args.Add("event", action)
+	}
+	return p.client.Events(ctx, types.EventsOptions{
+		Since:   since,
+		Filters: args,
+	})
+}
+
 func getDefaultNetwork(ctx context.Context, cli *client.Client) (string, error) {
 	// Get list of available networks
 	networkResources, err := cli.NetworkList(ctx, types.NetworkListOptions{})
@@ -728,6 +830,10 @@ func inAContainer() bool {
 	if _, err := os.Stat("/.dockerenv"); err == nil {
 		return true
 	}
+	// podman marks its containers with another file
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return true
+	}
 	return false
 }
 func getDefaultGatewayIP() (string, error) {
@@ -816,7 +922,6 @@ func (c *DockerContainer) PortEndpoint(ctx context.Context, port nat.Port, proto
 
 // Host gets host (ip or name) of the docker daemon where the container port is exposed
 // Warning: this is based on your Docker host setting. Will fail if using an SSH tunnel
-// You can use the "Host" env variable to set this yourself
 func (c *DockerContainer) Host(ctx context.Context) (string, error) {
 	host, err := c.provider.daemonHost(ctx)
 	if err != nil {
@@ -870,8 +975,13 @@ func (c *DockerContainer) SessionID() string {
 }
 
 // Start will start an already created container
-func (c *DockerContainer) Start(ctx context.Context, req ContainerRequest) error {
-	event.Publish(&event.ContainerEventData{
+func (c *DockerContainer) Start(ctx context.Context, req ContainerRequest) (err error) {
+	ctx, span := trace.Start(ctx, "start_container")
+	span.SetAttribute("container.name", req.Name).SetAttribute("container.image", req.Image)
+	defer func() {
+		span.Finish(err)
+	}()
+	event.Publish(ctx, &event.ContainerEventData{
 		PodName:       req.Labels[common.LabelPodName],
 		ContainerName: req.Labels[common.LabelContainerName],
 		Name:          req.Name,
@@ -889,14 +999,17 @@ func (c *DockerContainer) Start(ctx context.Context, req ContainerRequest) error
 	// if a Wait Strategy has been specified, wait before returning
 	if c.WaitingFor != nil {
 		c.logger.Printf("Waiting for container id: %s image: %s", shortID, c.Image)
-		if err := c.WaitingFor.WaitUntilReady(ctx, c); err != nil {
+		waitCtx, waitSpan := trace.Start(ctx, "waiting_for")
+		err := c.WaitingFor.WaitUntilReady(waitCtx, c)
+		waitSpan.SetAttribute("wait.strategy", fmt.Sprintf("%T", c.WaitingFor)).Finish(err)
+		if err != nil {
 			return err
 		}
 	}
 	state, err := c.State(ctx)
 	if err != nil || state.Running == false {
 		c.logger.Printf("Container is removed id: %s image: %s", shortID, c.Image)
-		event.Publish(&event.ContainerEventData{
+		event.Publish(ctx, &event.ContainerEventData{
 			PodName:       req.Labels[common.LabelPodName],
 			ContainerName: req.Labels[common.LabelContainerName],
 			Name:          req.Name,
@@ -906,7 +1019,7 @@ func (c *DockerContainer) Start(ctx context.Context, req ContainerRequest) error
 		})
 	} else {
 		c.logger.Printf("Container is ready id: %s image: %s", shortID, c.Image)
-		event.Publish(&event.ContainerEventData{
+		event.Publish(ctx, &event.ContainerEventData{
 			PodName:       req.Labels[common.LabelPodName],
 			ContainerName: req.Labels[common.LabelContainerName],
 			Name:          req.Name,
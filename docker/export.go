@@ -0,0 +1,296 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"podcompose/common"
+	"sort"
+	"strings"
+)
+
+// ExportVolume streams the files of the volume as a tar archive through a helper container that is never started,
+// the helper is removed when the archive is closed, a cache volume is exported by its name
+func (p *DockerProvider) ExportVolume(ctx context.Context, volumeName string, sessionId string) (io.ReadCloser, error) {
+	if !strings.HasSuffix(volumeName, sessionId) && !IsCacheVolume(volumeName) {
+		volumeName = volumeName + "_" + sessionId
+	}
+	return p.exportVolume(ctx, volumeName, common.ContainerNamePrefix+"export_"+volumeName, sessionId)
+}
+
+func (p *DockerProvider) exportVolume(ctx context.Context, volumeName string, helperName string, sessionId string) (io.ReadCloser, error) {
+	c, err := p.createVolumeHelper(ctx, volumeName, helperName, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	remove := func() {
+		p.removeVolumeHelper(c.GetContainerID())
+	}
+	archive, _, err := p.client.CopyFromContainer(ctx, c.GetContainerID(), volumeCopyPath+"/.")
+	if err != nil {
+		remove()
+		return nil, err
+	}
+	return &helperArchive{ReadCloser: archive, remove: remove}, nil
+}
+
+// helperArchive removes the helper container of the archive on close
+type helperArchive struct {
+	io.ReadCloser
+	remove func()
+}
+
+func (h *helperArchive) Close() error {
+	err := h.ReadCloser.Close()
+	h.remove()
+	return err
+}
+
+// exportSkippedVolumes are the volumes of the session ExportVolumes leaves out, they hold the agent logs, the
+// ingress config, the shipped context and the tls material of the engine instead of test data
+var exportSkippedVolumes = []string{common.SystemLogVolumeName, common.IngressVolumeName, common.ContextVolumeName, common.CertVolumeName}
+
+// ExportVolumeTo writes the files of the volume of the session to dest, a .tar file or a directory they are extracted into
+func ExportVolumeTo(ctx context.Context, runtime Runtime, volumeName string, sessionId string, dest string) error {
+	archive, err := runtime.ExportVolume(ctx, volumeName, sessionId)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	if strings.HasSuffix(dest, ".tar") {
+		return writeFile(dest, func(w io.Writer) error {
+			_, err := io.Copy(w, archive)
+			return err
+		})
+	}
+	return ExtractArchive(archive, dest)
+}
+
+// ExportVolumes writes the volumes of the session to dest like ExportVolumeTo, each one under the volume name
+// without the session suffix, so a failed test can be inspected from a single bundle, see exportSkippedVolumes,
+// sources are the volumes the containers mount instead of the session volume by volume name, e.g. a read only cache
+func ExportVolumes(ctx context.Context, runtime Runtime, sessionId string, dest string, sources map[string]string) error {
+	volumes, err := runtime.FindAllVolumesWithSessionId(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(volumes))
+	for _, v := range volumes {
+		if !exportSkipped(strings.TrimSuffix(v.Name, "_"+sessionId)) {
+			names = append(names, v.Name)
+		}
+	}
+	sort.Strings(names)
+	export := func(name string, write func(prefix string, archive io.Reader) error) error {
+		prefix := strings.TrimSuffix(name, "_"+sessionId)
+		if source, ok := sources[prefix]; ok {
+			name = source
+		}
+		archive, err := runtime.ExportVolume(ctx, name, sessionId)
+		if err != nil {
+			return errors.Wrapf(err, "export volume %s", name)
+		}
+		defer archive.Close()
+		return errors.Wrapf(write(prefix, archive), "export volume %s", name)
+	}
+	if !strings.HasSuffix(dest, ".tar") {
+		for _, name := range names {
+			err = export(name, func(prefix string, archive io.Reader) error {
+				return ExtractArchive(archive, filepath.Join(dest, prefix))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return writeFile(dest, func(w io.Writer) error {
+		tw := tar.NewWriter(w)
+		for _, name := range names {
+			if err := export(name, func(prefix string, archive io.Reader) error {
+				return prefixArchive(tw, prefix, archive)
+			}); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	})
+}
+
+func exportSkipped(name string) bool {
+	for _, skipped := range exportSkippedVolumes {
+		if name == skipped {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixArchive copies the entries of the archive under prefix
+func prefixArchive(tw *tar.Writer, prefix string, archive io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: prefix + "/", Mode: 0755}); err != nil {
+		return err
+	}
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, err := entryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		hdr.Name = path.Join(prefix, name)
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = path.Join(prefix, hdr.Linkname)
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err = io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// ExtractArchive writes the directories, files, symlinks and hard links of the tar archive under dir, entries
+// escaping dir through .. , an absolute path or a symlink of the archive fail the extraction, ownership is not kept
+func ExtractArchive(archive io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	links := make(map[string]bool)
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, err := entryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		if parent := symlinkParent(links, name); parent != "" {
+			return errors.Errorf("entry %s is written through the symlink %s", hdr.Name, parent)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		mode := os.FileMode(hdr.Mode).Perm()
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			// an entry replaces the one of the same name instead of writing through a symlink of an earlier entry
+			if err = removeExisting(target); err != nil {
+				return err
+			}
+			delete(links, name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			// the owner keeps the access the extraction needs
+			err = os.MkdirAll(target, mode|0700)
+		case tar.TypeReg:
+			err = extractFile(target, mode|0600, tr)
+		case tar.TypeSymlink:
+			links[name] = true
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		case tar.TypeLink:
+			err = extractLink(dir, links, hdr, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// symlinkParent is the symlink of the archive among the parents of the entry name, empty when there is none
+func symlinkParent(links map[string]bool, name string) string {
+	for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+		if links[parent] {
+			return parent
+		}
+	}
+	return ""
+}
+
+// extractLink recreates the hard link of the entry to the file of the archive it names
+func extractLink(dir string, links map[string]bool, hdr *tar.Header, target string) error {
+	linkname, err := entryName(hdr.Linkname)
+	if err != nil {
+		return err
+	}
+	if linkname == "" {
+		return errors.Errorf("entry %s links the archive root", hdr.Name)
+	}
+	if parent := symlinkParent(links, linkname); parent != "" {
+		return errors.Errorf("entry %s links %s through the symlink %s", hdr.Name, hdr.Linkname, parent)
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Link(filepath.Join(dir, filepath.FromSlash(linkname)), target)
+}
+
+// removeExisting removes the file or the symlink at target, a directory is kept
+func removeExisting(target string) error {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	return os.Remove(target)
+}
+
+func extractFile(target string, mode os.FileMode, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeFile(name string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
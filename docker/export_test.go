@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTar(t *testing.T, entries ...entry) *bytes.Buffer {
+	buffer := &bytes.Buffer{}
+	tw := tar.NewWriter(buffer)
+	for _, e := range entries {
+		if err := tw.WriteHeader(e.hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer
+}
+
+func TestExtractArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive := writeTar(t,
+		header(&tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0755}),
+		header(&tar.Header{Typeflag: tar.TypeDir, Name: "./sql/", Mode: 0500}),
+		file("./sql/init.sql", "select 1;"),
+		header(&tar.Header{Typeflag: tar.TypeSymlink, Name: "init.sql", Linkname: "sql/init.sql"}),
+		header(&tar.Header{Typeflag: tar.TypeLink, Name: "backup/init.sql", Linkname: "./sql/init.sql"}),
+	)
+	if err := ExtractArchive(archive, dir); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "init.sql")); err != nil || string(content) != "select 1;" {
+		t.Fatalf("unexpected extraction: %q %v", content, err)
+	}
+	linked, err := os.Lstat(filepath.Join(dir, "backup", "init.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original, _ := os.Lstat(filepath.Join(dir, "sql", "init.sql")); !os.SameFile(linked, original) {
+		t.Fatal("hard link is not recreated")
+	}
+
+	outside := t.TempDir()
+	cases := map[string][]entry{
+		"parent":   {file("../evil", "x")},
+		"absolute": {file("/etc/evil", "x")},
+		"symlink": {
+			header(&tar.Header{Typeflag: tar.TypeSymlink, Name: "etc", Linkname: "/etc"}),
+			file("etc/evil", "x"),
+		},
+		"link parent": {header(&tar.Header{Typeflag: tar.TypeLink, Name: "passwd", Linkname: "../passwd"})},
+		"file through symlink": {
+			header(&tar.Header{Typeflag: tar.TypeSymlink, Name: "evil", Linkname: filepath.Join(outside, "evil")}),
+			file("evil", "x"),
+		},
+		"link through symlink": {
+			header(&tar.Header{Typeflag: tar.TypeSymlink, Name: "etc", Linkname: "/etc"}),
+			header(&tar.Header{Typeflag: tar.TypeLink, Name: "passwd", Linkname: "etc/passwd"}),
+		},
+	}
+	for name, entries := range cases {
+		err := ExtractArchive(writeTar(t, entries...), filepath.Join(dir, name))
+		if _, statErr := os.Lstat(filepath.Join(outside, "evil")); statErr == nil {
+			t.Fatalf("%s is written outside of the directory", name)
+		}
+		if name == "file through symlink" {
+			// the file replaces the symlink of the same name
+			if content, _ := os.ReadFile(filepath.Join(dir, name, "evil")); err != nil || string(content) != "x" {
+				t.Fatalf("%s should replace the symlink: %q %v", name, content, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%s should fail the extraction", name)
+		}
+	}
+}
+
+func TestPrefixArchive(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	tw := tar.NewWriter(buffer)
+	archive := writeTar(t,
+		header(&tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0755}),
+		file("./init.sql", "select 1;"),
+		header(&tar.Header{Typeflag: tar.TypeLink, Name: "copy.sql", Linkname: "init.sql"}),
+	)
+	if err := prefixArchive(tw, "data", archive); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	headers, contents := readArchive(t, io.NopCloser(buffer))
+	if len(headers) != 3 || contents["data/init.sql"] != "select 1;" || headers["data/copy.sql"].Linkname != "data/init.sql" {
+		t.Fatalf("unexpected entries: %v", headers)
+	}
+}
@@ -0,0 +1,240 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"podcompose/docker"
+	"podcompose/docker/wait"
+	"podcompose/event"
+	"time"
+)
+
+// Container is a container of the fake runtime, files copied into it are kept in memory
+type Container struct {
+	runtime   *Runtime
+	id        string
+	name      string
+	sessionId string
+	req       docker.ContainerRequest
+	state     types.ContainerState
+	files     map[string][]byte
+	execs     [][]string
+	logs      bytes.Buffer
+	consumers []docker.LogConsumer
+}
+
+var _ docker.Container = (*Container)(nil)
+
+func (c *Container) GetContainerID() string {
+	return c.id
+}
+
+func (c *Container) Endpoint(ctx context.Context, proto string) (string, error) {
+	ports, err := c.Ports(ctx)
+	if err != nil {
+		return "", err
+	}
+	for port := range ports {
+		return c.PortEndpoint(ctx, port, proto)
+	}
+	return "", errors.New("port not found")
+}
+
+func (c *Container) PortEndpoint(ctx context.Context, port nat.Port, proto string) (string, error) {
+	mappedPort, err := c.MappedPort(ctx, port)
+	if err != nil {
+		return "", err
+	}
+	if proto != "" {
+		proto = proto + "://"
+	}
+	return fmt.Sprintf("%slocalhost:%s", proto, mappedPort.Port()), nil
+}
+
+func (c *Container) Host(ctx context.Context) (string, error) {
+	return "localhost", nil
+}
+
+// MappedPort returns the port itself, the fake does not allocate host ports
+func (c *Container) MappedPort(ctx context.Context, port nat.Port) (nat.Port, error) {
+	ports, err := c.Ports(ctx)
+	if err != nil {
+		return "", err
+	}
+	for k := range ports {
+		if k.Port() == port.Port() && (port.Proto() == "" || k.Proto() == port.Proto()) {
+			return k, nil
+		}
+	}
+	return "", errors.New("port not found")
+}
+
+func (c *Container) Ports(ctx context.Context) (nat.PortMap, error) {
+	_, portMap, err := nat.ParsePortSpecs(c.req.ExposedPorts)
+	return portMap, err
+}
+
+func (c *Container) SessionID() string {
+	return c.sessionId
+}
+
+func (c *Container) Start(ctx context.Context, req docker.ContainerRequest) error {
+	publishContainerEvent(ctx, c.req, c.id, event.ContainerEventStartType)
+	if c.runtime.OnStart != nil {
+		if err := c.runtime.OnStart(c.req); err != nil {
+			return err
+		}
+	}
+	c.runtime.lock.Lock()
+	if _, ok := c.runtime.containers[c.id]; !ok {
+		c.runtime.lock.Unlock()
+		return errors.Errorf("No such container: %s", c.id)
+	}
+	c.runtime.start(c)
+	if _, ok := c.req.WaitingFor.(*wait.ExitStrategy); ok {
+		exitCode := 0
+		if c.runtime.ExitCode != nil {
+			exitCode = c.runtime.ExitCode(c.req)
+		}
+		c.runtime.exit(c, exitCode, "")
+	}
+	c.runtime.lock.Unlock()
+	publishContainerEvent(ctx, c.req, c.id, event.ContainerEventReadyType)
+	return nil
+}
+
+func (c *Container) Stop(ctx context.Context, timeout *time.Duration) error {
+	c.runtime.lock.Lock()
+	defer c.runtime.lock.Unlock()
+	if c.state.Running {
+		c.runtime.exit(c, 0, "kill")
+	}
+	return nil
+}
+
+func (c *Container) Terminate(ctx context.Context) error {
+	return c.runtime.RemoveContainer(ctx, c.id)
+}
+
+func (c *Container) Logs(ctx context.Context) (io.ReadCloser, error) {
+	c.runtime.lock.Lock()
+	defer c.runtime.lock.Unlock()
+	return io.NopCloser(bytes.NewReader(c.logs.Bytes())), nil
+}
+
+func (c *Container) FollowOutput(consumer docker.LogConsumer) {
+	c.runtime.lock.Lock()
+	defer c.runtime.lock.Unlock()
+	c.consumers = append(c.consumers, consumer)
+}
+
+func (c *Container) StartLogProducer(ctx context.Context) error {
+	return nil
+}
+
+func (c *Container) StopLogProducer() error {
+	return nil
+}
+
+// Log appends a line to the logs of the container and passes it to the consumers
+func (c *Container) Log(content string) {
+	c.runtime.lock.Lock()
+	c.logs.WriteString(content)
+	consumers := append([]docker.LogConsumer(nil), c.consumers...)
+	c.runtime.lock.Unlock()
+	for _, consumer := range consumers {
+		consumer.Accept(docker.Log{LogType: docker.StdoutLog, Content: []byte(content)})
+	}
+}
+
+func (c *Container) Name(ctx context.Context) (string, error) {
+	return "/" + c.name, nil
+}
+
+func (c *Container) State(ctx context.Context) (*types.ContainerState, error) {
+	return c.runtime.State(ctx, c.id)
+}
+
+func (c *Container) Networks(ctx context.Context) ([]string, error) {
+	return c.req.Networks, nil
+}
+
+func (c *Container) NetworkAliases(ctx context.Context) (map[string][]string, error) {
+	return c.req.NetworkAliases, nil
+}
+
+// Exec records the command, the exit code comes from Runtime.OnExec
+func (c *Container) Exec(ctx context.Context, cmd []string) (int, error) {
+	c.runtime.lock.Lock()
+	c.execs = append(c.execs, cmd)
+	c.runtime.lock.Unlock()
+	if c.runtime.OnExec != nil {
+		return c.runtime.OnExec(c.name, cmd), nil
+	}
+	return 0, nil
+}
+
+// Execs returns the commands run in the container
+func (c *Container) Execs() [][]string {
+	c.runtime.lock.Lock()
+	defer c.runtime.lock.Unlock()
+	return append([][]string(nil), c.execs...)
+}
+
+func (c *Container) ContainerIP(ctx context.Context) (string, error) {
+	return "127.0.0.1", nil
+}
+
+func (c *Container) CopyToContainer(ctx context.Context, fileContent []byte, containerFilePath string, fileMode int64) error {
+	c.runtime.lock.Lock()
+	defer c.runtime.lock.Unlock()
+	c.files[containerFilePath] = append([]byte(nil), fileContent...)
+	return nil
+}
+
+func (c *Container) CopyFileToContainer(ctx context.Context, hostFilePath string, containerFilePath string, fileMode int64) error {
+	fileContent, err := os.ReadFile(hostFilePath)
+	if err != nil {
+		return err
+	}
+	return c.CopyToContainer(ctx, fileContent, containerFilePath, fileMode)
+}
+
+func (c *Container) CopyFileFromContainer(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	c.runtime.lock.Lock()
+	defer c.runtime.lock.Unlock()
+	fileContent, ok := c.files[filePath]
+	if !ok {
+		return nil, errors.Errorf("Could not find the file %s in container %s", filePath, c.id)
+	}
+	return io.NopCloser(bytes.NewReader(fileContent)), nil
+}
+
+// summary is called with the lock held
+func (c *Container) summary() types.Container {
+	return types.Container{
+		ID:      c.id,
+		Names:   []string{"/" + c.name},
+		Image:   c.req.Image,
+		Labels:  c.req.Labels,
+		State:   c.state.Status,
+		Status:  c.state.Status,
+		Command: fmt.Sprint(c.req.Cmd),
+	}
+}
+
+// mountsVolume is called with the lock held
+func (c *Container) mountsVolume(volumeName string) bool {
+	for _, m := range c.req.Mounts {
+		if m.Source.Type() == docker.MountTypeVolume && m.Source.Source() == volumeName {
+			return true
+		}
+	}
+	return false
+}
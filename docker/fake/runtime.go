@@ -0,0 +1,740 @@
+package fake
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+	"podcompose/common"
+	"podcompose/docker"
+	"podcompose/event"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const eventBufferSize = 256
+
+// Runtime is an in-memory docker.Runtime, containers are running as soon as they are started
+// and their wait strategies are not run, images are always present.
+// Containers waiting for their exit, like the init and agent containers, exit right after the start
+type Runtime struct {
+	lock        sync.Mutex
+	seq         int
+	containers  map[string]*Container
+	networks    map[string]*types.NetworkResource
+	volumes     map[string]*types.Volume
+	volumeData  map[string]map[string][]byte
+	started     []string
+	subscribers map[*subscriber]bool
+	// Engine is the engine reported by Capabilities, docker when empty
+	Engine string
+	// Remote reports an engine on another machine at tcp://fake:2376 instead of a local socket
+	Remote bool
+	// OnStart is called before a container starts, an error fails the start, e.g. to fail a pod in tests
+	OnStart func(req docker.ContainerRequest) error
+	// ExitCode returns the exit code of a container waiting for its exit, 0 when nil
+	ExitCode func(req docker.ContainerRequest) int
+	// OnCopy is called before an archive is copied into a volume, an error fails the copy
+	OnCopy func(volumeName string) error
+	// OnExec returns the exit code of a command run in a container, 0 when nil
+	OnExec func(containerName string, cmd []string) int
+}
+
+type subscriber struct {
+	sessionId string
+	actions   map[string]bool
+	messages  chan events.Message
+}
+
+var _ docker.Runtime = (*Runtime)(nil)
+
+func NewRuntime() *Runtime {
+	return &Runtime{
+		containers:  make(map[string]*Container),
+		networks:    make(map[string]*types.NetworkResource),
+		volumes:     make(map[string]*types.Volume),
+		volumeData:  make(map[string]map[string][]byte),
+		subscribers: make(map[*subscriber]bool),
+	}
+}
+
+func (r *Runtime) Health(ctx context.Context) error {
+	return nil
+}
+
+func (r *Runtime) Capabilities() docker.Capabilities {
+	capabilities := docker.Capabilities{Engine: r.Engine, Host: "unix://" + docker.AgentSocketPath, SocketPath: docker.AgentSocketPath}
+	if r.Engine == "" {
+		capabilities.Engine = docker.EngineDocker
+	}
+	if r.Remote {
+		capabilities.Host = "tcp://fake:2376"
+		capabilities.SocketPath = ""
+		capabilities.Remote = true
+	}
+	return capabilities
+}
+
+func (r *Runtime) GetDefaultNetwork() string {
+	if r.Engine == docker.EnginePodman {
+		return docker.PodmanNetwork
+	}
+	return docker.Bridge
+}
+
+// Started returns the names of the started containers in start order
+func (r *Runtime) Started() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.started...)
+}
+
+func (r *Runtime) CreateContainer(ctx context.Context, req docker.ContainerRequest, sessionId string, autoLabel bool) (docker.Container, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string)
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+	if autoLabel {
+		labels[docker.PodContainerLabel] = "true"
+		labels[docker.ComposeSessionID] = sessionId
+	}
+	req.Labels = labels
+	r.lock.Lock()
+	for _, c := range r.containers {
+		if req.Name != "" && c.name == req.Name {
+			r.lock.Unlock()
+			return nil, errors.Errorf("Conflict. The container name \"/%s\" is already in use by container \"%s\"", req.Name, c.id)
+		}
+	}
+	for _, m := range req.Mounts {
+		if m.Source.Type() != docker.MountTypeVolume {
+			continue
+		}
+		if _, ok := r.volumes[m.Source.Source()]; !ok {
+			// docker creates missing volumes on the fly
+			r.volumes[m.Source.Source()] = &types.Volume{Name: m.Source.Source(), Driver: "local", Labels: map[string]string{}}
+		}
+	}
+	r.seq++
+	c := &Container{
+		runtime:   r,
+		id:        fmt.Sprintf("%064x", r.seq),
+		name:      req.Name,
+		sessionId: sessionId,
+		req:       req,
+		state:     types.ContainerState{Status: "created"},
+		files:     make(map[string][]byte),
+	}
+	if c.name == "" {
+		c.name = "fake_" + strconv.Itoa(r.seq)
+	}
+	r.containers[c.id] = c
+	r.lock.Unlock()
+	publishContainerEvent(ctx, req, c.id, event.ContainerEventCreatedType)
+	return c, nil
+}
+
+func (r *Runtime) CreateContainerAutoLabel(ctx context.Context, req docker.ContainerRequest, sessionId string) (docker.Container, error) {
+	return r.CreateContainer(ctx, req, sessionId, true)
+}
+
+func (r *Runtime) RunContainer(ctx context.Context, req docker.ContainerRequest, sessionId string) (docker.Container, error) {
+	c, err := r.CreateContainerAutoLabel(ctx, req, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(ctx, req); err != nil {
+		return c, fmt.Errorf("%w: could not start container", err)
+	}
+	return c, nil
+}
+
+func (r *Runtime) RemoveContainer(ctx context.Context, id string) error {
+	r.lock.Lock()
+	c, ok := r.containers[id]
+	if !ok {
+		r.lock.Unlock()
+		return errors.Errorf("No such container: %s", id)
+	}
+	if c.state.Running {
+		r.exit(c, 137, "kill")
+	}
+	delete(r.containers, id)
+	r.emit(c, "destroy", nil)
+	r.lock.Unlock()
+	publishContainerEvent(ctx, c.req, id, event.ContainerEventRemoveType)
+	return nil
+}
+
+func (r *Runtime) FindAllPodContainers(ctx context.Context) ([]types.Container, error) {
+	return r.list(func(c *Container) bool {
+		return c.req.Labels[docker.PodContainerLabel] == "true"
+	}), nil
+}
+
+func (r *Runtime) FindAllContainersWithSessionId(ctx context.Context, sessionId string) ([]types.Container, error) {
+	return r.list(func(c *Container) bool {
+		return c.req.Labels[docker.ComposeSessionID] == sessionId
+	}), nil
+}
+
+// FindContainers lists the running pod containers of the session like docker ps
+func (r *Runtime) FindContainers(ctx context.Context, sessionId string) ([]types.Container, error) {
+	return r.list(func(c *Container) bool {
+		return c.state.Running && c.req.Labels[docker.PodContainerLabel] == "true" && c.req.Labels[docker.ComposeSessionID] == sessionId
+	}), nil
+}
+
+func (r *Runtime) FindContainerByName(ctx context.Context, name string) (*types.Container, error) {
+	list := r.list(func(c *Container) bool {
+		return c.state.Running && c.name == name
+	})
+	if len(list) == 0 {
+		return nil, errors.Errorf("not found container name is %s", name)
+	}
+	return &list[0], nil
+}
+
+func (r *Runtime) State(ctx context.Context, id string) (*types.ContainerState, error) {
+	inspect, err := r.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return inspect.State, nil
+}
+
+func (r *Runtime) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return types.ContainerJSON{}, errors.Errorf("No such container: %s", id)
+	}
+	state := c.state
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    c.id,
+			Name:  "/" + c.name,
+			Image: c.req.Image,
+			State: &state,
+			HostConfig: &container.HostConfig{
+				NetworkMode: c.req.NetworkMode,
+			},
+		},
+		Config: &container.Config{
+			Image:  c.req.Image,
+			Labels: c.req.Labels,
+		},
+	}, nil
+}
+
+// ContainerStats has no usage to report, the body is empty
+func (r *Runtime) ContainerStats(ctx context.Context, id string) (types.ContainerStats, error) {
+	if _, err := r.ContainerInspect(ctx, id); err != nil {
+		return types.ContainerStats{}, err
+	}
+	return types.ContainerStats{Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+// ContainerEvents streams the container events of the session from now on, since is ignored
+func (r *Runtime) ContainerEvents(ctx context.Context, sessionId string, since string, actions ...string) (<-chan events.Message, <-chan error) {
+	s := &subscriber{
+		sessionId: sessionId,
+		actions:   make(map[string]bool),
+		messages:  make(chan events.Message, eventBufferSize),
+	}
+	for _, action := range actions {
+		s.actions[action] = true
+	}
+	errs := make(chan error, 1)
+	r.lock.Lock()
+	r.subscribers[s] = true
+	r.lock.Unlock()
+	go func() {
+		<-ctx.Done()
+		r.lock.Lock()
+		delete(r.subscribers, s)
+		r.lock.Unlock()
+		errs <- ctx.Err()
+	}()
+	return s.messages, errs
+}
+
+func (r *Runtime) CreateNetwork(ctx context.Context, req docker.NetworkRequest, sessionId string) (docker.Network, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.networks[req.Name]; ok && req.CheckDuplicate {
+		return nil, errors.Errorf("network with name %s already exists", req.Name)
+	}
+	labels := make(map[string]string)
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+	labels[docker.PodContainerLabel] = "true"
+	labels[docker.ComposeSessionID] = sessionId
+	r.seq++
+	n := &types.NetworkResource{
+		ID:     fmt.Sprintf("%064x", r.seq),
+		Name:   req.Name,
+		Driver: req.Driver,
+		Labels: labels,
+	}
+	r.networks[req.Name] = n
+	return &Network{runtime: r, id: n.ID}, nil
+}
+
+func (r *Runtime) GetNetwork(ctx context.Context, req docker.NetworkRequest) (types.NetworkResource, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if req.Name == docker.Bridge {
+		return types.NetworkResource{ID: docker.Bridge, Name: docker.Bridge, Driver: docker.Bridge}, nil
+	}
+	for _, n := range r.networks {
+		if n.Name == req.Name || n.ID == req.Name {
+			return *n, nil
+		}
+	}
+	return types.NetworkResource{}, errors.Errorf("network %s not found", req.Name)
+}
+
+func (r *Runtime) RemoveNetwork(ctx context.Context, networkID string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for name, n := range r.networks {
+		if n.ID == networkID || n.Name == networkID {
+			delete(r.networks, name)
+			return nil
+		}
+	}
+	return errors.Errorf("network %s not found", networkID)
+}
+
+func (r *Runtime) FindAllNetworks(ctx context.Context) ([]types.NetworkResource, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]types.NetworkResource, 0)
+	for _, n := range r.networks {
+		if n.Labels[docker.PodContainerLabel] == "true" {
+			result = append(result, *n)
+		}
+	}
+	return result, nil
+}
+
+// CreateVolume returns the existing volume when the name is used, like docker does
+func (r *Runtime) CreateVolume(ctx context.Context, name string, sessionId string, volumeGroup string) (types.Volume, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	name = name + "_" + sessionId
+	if v, ok := r.volumes[name]; ok {
+		return *v, nil
+	}
+	v := &types.Volume{
+		Driver: "local",
+		Name:   name,
+		Labels: map[string]string{
+			docker.PodContainerLabel: "true",
+			docker.ComposeSessionID:  sessionId,
+			docker.VolumeGroup:       volumeGroup,
+		},
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	r.volumes[name] = v
+	return *v, nil
+}
+
+// RemoveVolume fails when a container still mounts the volume, force does not change it like in docker
+func (r *Runtime) RemoveVolume(ctx context.Context, volumeName string, sessionId string, force bool) error {
+	if !strings.HasSuffix(volumeName, sessionId) {
+		volumeName = volumeName + "_" + sessionId
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.volumes[volumeName]; !ok {
+		return errors.Errorf("get %s: no such volume", volumeName)
+	}
+	for _, c := range r.containers {
+		if c.mountsVolume(volumeName) {
+			return errors.Errorf("remove %s: volume is in use - [%s]", volumeName, c.id)
+		}
+	}
+	delete(r.volumes, volumeName)
+	delete(r.volumeData, volumeName)
+	return nil
+}
+
+// CopyToVolume keeps the regular files of the archive, the volume is created when it is missing like docker does
+func (r *Runtime) CopyToVolume(ctx context.Context, volumeName string, sessionId string, archive io.Reader) error {
+	if !strings.HasSuffix(volumeName, sessionId) {
+		volumeName = volumeName + "_" + sessionId
+	}
+	return r.copyToVolume(volumeName, archive)
+}
+
+func (r *Runtime) copyToVolume(volumeName string, archive io.Reader) error {
+	if r.OnCopy != nil {
+		if err := r.OnCopy(volumeName); err != nil {
+			return err
+		}
+	}
+	files, err := readArchive(archive)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.volumes[volumeName]; !ok {
+		r.volumes[volumeName] = &types.Volume{Name: volumeName, Driver: "local", Labels: map[string]string{}}
+	}
+	if r.volumeData[volumeName] == nil {
+		r.volumeData[volumeName] = make(map[string][]byte)
+	}
+	for name, content := range files {
+		r.volumeData[volumeName][name] = content
+	}
+	return nil
+}
+
+func readArchive(archive io.Reader) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(hdr.Name)] = content
+	}
+}
+
+// FindCacheVolume only returns cache volumes that have a marker volume like DockerProvider
+func (r *Runtime) FindCacheVolume(ctx context.Context, hash string) (*types.Volume, error) {
+	markers := r.listVolumes(func(v *types.Volume) bool {
+		return v.Labels[docker.CacheHashLabel] == hash && v.Labels[docker.CacheCompleteLabel] != ""
+	})
+	for _, marker := range markers {
+		if v, ok := r.Volume(marker.Labels[docker.CacheCompleteLabel]); ok {
+			return &v, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateCacheVolume keeps the regular files of the archive like CopyToVolume, OnCopy gets the cache volume name
+// while the cache volume exists without its marker
+func (r *Runtime) CreateCacheVolume(ctx context.Context, hash string, source string, sessionId string, archive io.Reader) (types.Volume, error) {
+	name := docker.CacheVolumeName(hash, sessionId)
+	v := &types.Volume{
+		Driver: "local",
+		Name:   name,
+		Labels: map[string]string{
+			docker.CacheVolumeLabel: "true",
+			docker.CacheHashLabel:   hash,
+			docker.CacheSourceLabel: source,
+		},
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	r.lock.Lock()
+	r.volumes[name] = v
+	r.lock.Unlock()
+	err := r.copyToVolume(name, archive)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err != nil {
+		delete(r.volumes, name)
+		delete(r.volumeData, name)
+		return *v, err
+	}
+	r.volumes[name+"_complete"] = &types.Volume{
+		Driver: "local",
+		Name:   name + "_complete",
+		Labels: map[string]string{
+			docker.CacheHashLabel:     hash,
+			docker.CacheCompleteLabel: name,
+		},
+	}
+	return *v, nil
+}
+
+func (r *Runtime) FindAllCacheVolumes(ctx context.Context) ([]*types.Volume, error) {
+	return r.listVolumes(func(v *types.Volume) bool {
+		return v.Labels[docker.CacheVolumeLabel] == "true"
+	}), nil
+}
+
+// RemoveCacheVolume fails when a container still mounts the volume, the marker is removed with it
+func (r *Runtime) RemoveCacheVolume(ctx context.Context, name string) error {
+	if err := r.RemoveVolume(ctx, name, "", false); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.volumes, name+"_complete")
+	return nil
+}
+
+func (r *Runtime) CloneVolume(ctx context.Context, from string, volumeName string, sessionId string) error {
+	if !strings.HasSuffix(volumeName, sessionId) {
+		volumeName = volumeName + "_" + sessionId
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.volumes[from]; !ok {
+		return errors.Errorf("get %s: no such volume", from)
+	}
+	if _, ok := r.volumes[volumeName]; !ok {
+		r.volumes[volumeName] = &types.Volume{Name: volumeName, Driver: "local", Labels: map[string]string{}}
+	}
+	if r.volumeData[volumeName] == nil {
+		r.volumeData[volumeName] = make(map[string][]byte)
+	}
+	for name, content := range r.volumeData[from] {
+		r.volumeData[volumeName][name] = content
+	}
+	return nil
+}
+
+// ExportVolume archives the files copied into the volume in name order
+func (r *Runtime) ExportVolume(ctx context.Context, volumeName string, sessionId string) (io.ReadCloser, error) {
+	if !strings.HasSuffix(volumeName, sessionId) && !docker.IsCacheVolume(volumeName) {
+		volumeName = volumeName + "_" + sessionId
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.volumes[volumeName]; !ok {
+		return nil, errors.Errorf("get %s: no such volume", volumeName)
+	}
+	names := make([]string, 0, len(r.volumeData[volumeName]))
+	for name := range r.volumeData[volumeName] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buffer := &bytes.Buffer{}
+	tw := tar.NewWriter(buffer)
+	for _, name := range names {
+		content := r.volumeData[volumeName][name]
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(buffer), nil
+}
+
+func (r *Runtime) CreateSnapshotVolume(ctx context.Context, volumeName string, snapshot string, sessionId string) (types.Volume, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	name := docker.SnapshotVolumeName(volumeName, snapshot) + "_" + sessionId
+	v := &types.Volume{
+		Driver: "local",
+		Name:   name,
+		Labels: map[string]string{
+			docker.PodContainerLabel:   "true",
+			docker.ComposeSessionID:    sessionId,
+			docker.SnapshotLabel:       snapshot,
+			docker.SnapshotVolumeLabel: volumeName,
+		},
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	r.volumes[name] = v
+	return *v, nil
+}
+
+// VolumeFiles returns the files copied into the volume by their path in it, sessionId suffix included in the name
+func (r *Runtime) VolumeFiles(name string) map[string][]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	files := make(map[string][]byte)
+	for k, v := range r.volumeData[name] {
+		files[k] = v
+	}
+	return files
+}
+
+func (r *Runtime) FindAllVolumes(ctx context.Context) ([]*types.Volume, error) {
+	return r.listVolumes(func(v *types.Volume) bool {
+		return v.Labels[docker.PodContainerLabel] == "true"
+	}), nil
+}
+
+func (r *Runtime) FindAllVolumesWithSessionId(ctx context.Context, sessionId string) ([]*types.Volume, error) {
+	return r.listVolumes(func(v *types.Volume) bool {
+		return v.Labels[docker.ComposeSessionID] == sessionId
+	}), nil
+}
+
+// Volume returns the volume of the name, sessionId suffix included
+func (r *Runtime) Volume(name string) (types.Volume, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	v, ok := r.volumes[name]
+	if !ok {
+		return types.Volume{}, false
+	}
+	return *v, true
+}
+
+func (r *Runtime) ClearWithSession(ctx context.Context, sessionId string) {
+	if sessionId == "" {
+		return
+	}
+	cs, _ := r.FindAllContainersWithSessionId(ctx, sessionId)
+	for _, c := range cs {
+		if c.Labels[docker.AgentType] == docker.AgentTypeCleaner {
+			continue
+		}
+		_ = r.RemoveContainer(ctx, c.ID)
+	}
+	vs, _ := r.FindAllVolumesWithSessionId(ctx, sessionId)
+	for _, v := range vs {
+		_ = r.RemoveVolume(ctx, v.Name, sessionId, true)
+	}
+	ns, _ := r.FindAllNetworks(ctx)
+	for _, n := range ns {
+		if n.Labels[docker.ComposeSessionID] == sessionId {
+			_ = r.RemoveNetwork(ctx, n.ID)
+		}
+	}
+}
+
+// Exit stops a running container with the exit code as if its process ended
+func (r *Runtime) Exit(id string, exitCode int) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return errors.Errorf("No such container: %s", id)
+	}
+	if c.state.Running {
+		r.exit(c, exitCode, "")
+	}
+	return nil
+}
+
+func (r *Runtime) list(filter func(c *Container) bool) []types.Container {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]types.Container, 0)
+	for _, c := range r.containers {
+		if filter(c) {
+			result = append(result, c.summary())
+		}
+	}
+	return result
+}
+
+func (r *Runtime) listVolumes(filter func(v *types.Volume) bool) []*types.Volume {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]*types.Volume, 0)
+	for _, v := range r.volumes {
+		if filter(v) {
+			v := *v
+			result = append(result, &v)
+		}
+	}
+	return result
+}
+
+// start is called with the lock held
+func (r *Runtime) start(c *Container) {
+	c.state = types.ContainerState{
+		Status:    "running",
+		Running:   true,
+		Pid:       r.seq,
+		StartedAt: time.Now().Format(time.RFC3339Nano),
+	}
+	r.started = append(r.started, c.name)
+	r.emit(c, "start", nil)
+}
+
+// exit is called with the lock held, action is the event sent before die, e.g. kill
+func (r *Runtime) exit(c *Container, exitCode int, action string) {
+	c.state.Running = false
+	c.state.Status = "exited"
+	c.state.ExitCode = exitCode
+	c.state.FinishedAt = time.Now().Format(time.RFC3339Nano)
+	if action != "" {
+		r.emit(c, action, nil)
+	}
+	r.emit(c, "die", map[string]string{"exitCode": strconv.Itoa(exitCode)})
+}
+
+// emit is called with the lock held, the event is dropped for a subscriber whose buffer is full
+func (r *Runtime) emit(c *Container, action string, attributes map[string]string) {
+	msg := events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         c.id,
+			Attributes: make(map[string]string),
+		},
+		Time:     time.Now().Unix(),
+		TimeNano: time.Now().UnixNano(),
+	}
+	for k, v := range c.req.Labels {
+		msg.Actor.Attributes[k] = v
+	}
+	for k, v := range attributes {
+		msg.Actor.Attributes[k] = v
+	}
+	msg.Actor.Attributes["name"] = c.name
+	msg.Actor.Attributes["image"] = c.req.Image
+	for s := range r.subscribers {
+		if c.req.Labels[docker.ComposeSessionID] != s.sessionId || (len(s.actions) > 0 && !s.actions[action]) {
+			continue
+		}
+		select {
+		case s.messages <- msg:
+		default:
+		}
+	}
+}
+
+func publishContainerEvent(ctx context.Context, req docker.ContainerRequest, id string, eventType string) {
+	event.Publish(ctx, &event.ContainerEventData{
+		PodName:       req.Labels[common.LabelPodName],
+		ContainerName: req.Labels[common.LabelContainerName],
+		Type:          eventType,
+		Id:            id,
+		Name:          req.Name,
+		Image:         req.Image,
+	})
+}
+
+// Network is a network of the fake runtime
+type Network struct {
+	runtime *Runtime
+	id      string
+}
+
+func (n *Network) Remove(ctx context.Context) error {
+	return n.runtime.RemoveNetwork(ctx, n.id)
+}
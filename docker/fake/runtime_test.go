@@ -0,0 +1,48 @@
+package fake
+
+import (
+	"context"
+	"podcompose/docker"
+	"testing"
+	"time"
+)
+
+func TestRuntime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRuntime()
+	messages, _ := r.ContainerEvents(ctx, "s1", "", "start", "die", "destroy")
+	if _, err := r.CreateVolume(ctx, "data", "s1", "g1"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.RunContainer(ctx, docker.ContainerRequest{
+		Name:   "db",
+		Image:  "mysql",
+		Mounts: docker.Mounts(docker.VolumeMount("data_s1", "/data")),
+	}, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RunContainer(ctx, docker.ContainerRequest{Name: "db", Image: "mysql"}, "s1"); err == nil {
+		t.Fatal("expect a name conflict")
+	}
+	if err := r.RemoveVolume(ctx, "data", "s1", true); err == nil {
+		t.Fatal("expect the volume to be in use")
+	}
+	if err := r.RemoveContainer(ctx, c.GetContainerID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RemoveVolume(ctx, "data", "s1", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"start", "die", "destroy"} {
+		select {
+		case msg := <-messages:
+			if msg.Action != action || msg.Actor.Attributes["name"] != "db" {
+				t.Fatalf("expect %s event, got %+v", action, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expect %s event", action)
+		}
+	}
+}
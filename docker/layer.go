@@ -0,0 +1,143 @@
+package docker
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// WhiteoutPrefix marks a deletion in an upper layer, the entry .wh.<name> removes name and everything under it
+// from the layers below and is not written itself
+const WhiteoutPrefix = ".wh."
+
+// ArchiveLayers streams the layers, the base first, as one tar archive like ArchiveSource, an entry of an upper
+// layer replaces the entry of the same path below and its whiteouts remove paths of the layers below,
+// the whiteouts are never written so a single layer is ArchiveSource without them, a volume that does not
+// extend another one is seeded with ArchiveSource and keeps its .wh. files
+func ArchiveLayers(srcs []string, options ArchiveOptions) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeLayers(writer, srcs, options, false))
+	}()
+	return reader
+}
+
+// HashLayers is HashSource of the layers merged like ArchiveLayers
+func HashLayers(srcs []string, options ArchiveOptions) (string, error) {
+	options.Progress = nil
+	hash := sha256.New()
+	if err := writeLayers(hash, srcs, options, true); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// layerMerger writes the layers from the top down, a path written or whited out by an upper layer is skipped
+// in the layers below so the extraction order does not matter
+type layerMerger struct {
+	tw       *tar.Writer
+	progress func(files int, bytes int64)
+	files    int
+	bytes    int64
+	// written are the paths of the upper layers, true for directories
+	written   map[string]bool
+	whiteouts map[string]bool
+}
+
+func writeLayers(w io.Writer, srcs []string, options ArchiveOptions, normalize bool) error {
+	m := &layerMerger{
+		tw:        tar.NewWriter(w),
+		progress:  options.Progress,
+		written:   make(map[string]bool),
+		whiteouts: make(map[string]bool),
+	}
+	options.Progress = nil
+	for i := len(srcs) - 1; i >= 0; i-- {
+		if err := m.merge(srcs[i], options, normalize); err != nil {
+			return errors.Wrapf(err, "layer %s", srcs[i])
+		}
+	}
+	return m.tw.Close()
+}
+
+// merge copies the entries of the layer src kept by the layers above, its whiteouts only apply to the layers below
+func (m *layerMerger) merge(src string, options ArchiveOptions, normalize bool) error {
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeSource(writer, src, options, normalize))
+	}()
+	defer reader.Close()
+	whiteouts := make([]string, 0)
+	written := make(map[string]bool)
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, err := entryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		if base := path.Base(name); strings.HasPrefix(base, WhiteoutPrefix) {
+			whiteouts = append(whiteouts, path.Join(path.Dir(name), strings.TrimPrefix(base, WhiteoutPrefix)))
+			continue
+		}
+		if m.removed(name) || (hdr.Typeflag == tar.TypeLink && m.removed(hdr.Linkname)) {
+			continue
+		}
+		if _, ok := m.written[name]; ok {
+			continue
+		}
+		written[name] = hdr.Typeflag == tar.TypeDir
+		if err = m.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		n, err := io.Copy(m.tw, tr)
+		if err != nil {
+			return err
+		}
+		m.files++
+		m.bytes += n
+		if m.progress != nil {
+			m.progress(m.files, m.bytes)
+		}
+	}
+	for name, isDir := range written {
+		m.written[name] = isDir
+	}
+	for _, name := range whiteouts {
+		m.whiteouts[name] = true
+	}
+	return nil
+}
+
+// removed is true when an upper layer whited out the path or one of its parents, or replaced a parent with a
+// file or a symlink
+func (m *layerMerger) removed(name string) bool {
+	if m.whiteouts[name] {
+		return true
+	}
+	for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+		if m.whiteouts[parent] {
+			return true
+		}
+		if isDir, ok := m.written[parent]; ok && !isDir {
+			return true
+		}
+	}
+	return false
+}
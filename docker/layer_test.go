@@ -0,0 +1,97 @@
+package docker
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchiveLayers(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base")
+	writeFiles(t, base, map[string]string{
+		"init.sql":       "select 1;",
+		"users.sql":      "insert users;",
+		"orders/1.sql":   "insert order 1;",
+		"reports/r.sql":  "select report;",
+		"settings/a.ini": "a=1",
+	})
+	overlay := filepath.Join(dir, "overlay")
+	writeFiles(t, overlay, map[string]string{
+		"init.sql":                   "select 2;",
+		WhiteoutPrefix + "users.sql": "",
+		WhiteoutPrefix + "orders":    "",
+		"reports":                    "replaced by a file",
+		"settings/b.ini":             "b=1",
+	})
+	progress := 0
+	headers, contents := readArchive(t, ArchiveLayers([]string{base, overlay}, ArchiveOptions{Progress: func(files int, bytes int64) {
+		progress = files
+	}}))
+	expected := map[string]string{
+		"init.sql":       "select 2;",
+		"reports":        "replaced by a file",
+		"settings/a.ini": "a=1",
+		"settings/b.ini": "b=1",
+	}
+	for name, hdr := range headers {
+		if hdr.Typeflag == tar.TypeDir {
+			delete(contents, name)
+		}
+	}
+	if len(contents) != len(expected) || progress != len(expected) {
+		t.Fatalf("unexpected files: %v, %d archived", contents, progress)
+	}
+	for name, content := range expected {
+		if contents[name] != content {
+			t.Fatalf("unexpected %s: %q", name, contents[name])
+		}
+	}
+	if hdr := headers["settings/"]; hdr == nil || hdr.Typeflag != tar.TypeDir {
+		t.Fatalf("directory of both layers should be kept once: %v", headers)
+	}
+	if _, ok := headers["orders/"]; ok {
+		t.Fatal("whited out directory should be removed")
+	}
+
+	layered, err := HashLayers([]string{base, overlay}, ArchiveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := HashLayers([]string{base, overlay}, ArchiveOptions{})
+	single, _ := HashLayers([]string{base}, ArchiveOptions{})
+	source, _ := HashSource(base, ArchiveOptions{})
+	if layered != again || layered == single || single != source {
+		t.Fatalf("unexpected hashes: %s %s %s %s", layered, again, single, source)
+	}
+}
+
+func TestArchiveSingleLayer(t *testing.T) {
+	base := t.TempDir()
+	writeFiles(t, base, map[string]string{
+		"init.sql":                   "select 1;",
+		WhiteoutPrefix + "users.sql": "",
+	})
+	_, contents := readArchive(t, ArchiveLayers([]string{base}, ArchiveOptions{}))
+	if len(contents) != 1 || contents["init.sql"] != "select 1;" {
+		t.Fatalf("whiteouts of a single layer should not be written: %v", contents)
+	}
+	single, _ := HashLayers([]string{base}, ArchiveOptions{})
+	source, _ := HashSource(base, ArchiveOptions{})
+	if single == source {
+		t.Fatal("whiteouts of a single layer should not be hashed")
+	}
+}
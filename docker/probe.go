@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"context"
+	"github.com/docker/docker/client"
+	"os"
+	"podcompose/config"
+	"strings"
+)
+
+const (
+	EngineDocker = "docker"
+	EnginePodman = "podman"
+	// PodmanNetwork is the default network of podman, it has no dns so pods only join the session network
+	PodmanNetwork = "podman"
+	// AgentSocketPath is where the engine socket of the host is mounted in the agent containers
+	AgentSocketPath = "/var/run/docker.sock"
+)
+
+// Capabilities describes the container engine, it is probed when the provider is created
+type Capabilities struct {
+	Engine     string
+	Version    string
+	ApiVersion string
+	Rootless   bool
+	// Host is the address of the engine api, SocketPath is set when it is a unix socket of this machine
+	// or the socket of the remote machine an ssh host tunnels to
+	Host       string
+	SocketPath string
+	// Remote is true when the engine is on another machine, see isRemote
+	Remote bool
+}
+
+// IsPodman is true for podman and its docker compatible api
+func (c Capabilities) IsPodman() bool {
+	return c.Engine == EnginePodman
+}
+
+// runtimeHost returns the address of the engine api, DOCKER_HOST first then the config,
+// empty for the default socket of the docker client
+func runtimeHost() string {
+	if host := os.Getenv(Host); host != "" {
+		return host
+	}
+	host := config.ComposeConfig.Runtime.Host
+	if strings.HasPrefix(host, "/") {
+		return "unix://" + host
+	}
+	return host
+}
+
+func socketPath(host string) string {
+	if strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	if strings.HasPrefix(host, "ssh://") {
+		return AgentSocketPath
+	}
+	return ""
+}
+
+// probe asks the engine what it is, host is the address the client was given
+func probe(ctx context.Context, c *client.Client, host string) (Capabilities, error) {
+	version, err := c.ServerVersion(ctx)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	capabilities := Capabilities{
+		Engine:     EngineDocker,
+		Version:    version.Version,
+		ApiVersion: version.APIVersion,
+		Host:       host,
+		SocketPath: socketPath(host),
+		Remote:     isRemote(host) || os.Getenv(RemoteEnv) == "true",
+	}
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), EnginePodman) {
+			capabilities.Engine = EnginePodman
+		}
+	}
+	info, err := c.Info(ctx)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	for _, securityOption := range info.SecurityOptions {
+		if strings.Contains(securityOption, "rootless") {
+			capabilities.Rootless = true
+		}
+	}
+	return capabilities, nil
+}
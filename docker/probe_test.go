@@ -0,0 +1,25 @@
+package docker
+
+import (
+	"podcompose/config"
+	"testing"
+)
+
+func TestRuntimeHost(t *testing.T) {
+	config.ComposeConfig.Runtime.Host = "/run/user/1000/podman/podman.sock"
+	defer func() { config.ComposeConfig.Runtime.Host = "" }()
+	t.Setenv(Host, "")
+	if host := runtimeHost(); host != "unix:///run/user/1000/podman/podman.sock" {
+		t.Fatalf("unexpected host of a socket path: %s", host)
+	}
+	if socket := socketPath(runtimeHost()); socket != "/run/user/1000/podman/podman.sock" {
+		t.Fatalf("unexpected socket: %s", socket)
+	}
+	t.Setenv(Host, "tcp://127.0.0.1:2375")
+	if host := runtimeHost(); host != "tcp://127.0.0.1:2375" {
+		t.Fatalf("DOCKER_HOST should take precedence, got %s", host)
+	}
+	if socket := socketPath(runtimeHost()); socket != "" {
+		t.Fatalf("unexpected socket of a tcp host: %s", socket)
+	}
+}
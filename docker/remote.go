@@ -0,0 +1,134 @@
+package docker
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// RemoteEnv marks the agents of a remote engine, their socket may be local to them but the context is not
+	RemoteEnv = "TPC_REMOTE_RUNTIME"
+	// CertPathEnv and TLSVerifyEnv are read by the docker client to talk tls to a tcp host
+	CertPathEnv  = "DOCKER_CERT_PATH"
+	TLSVerifyEnv = "DOCKER_TLS_VERIFY"
+	// sshClientHost is the dummy address of the api when it is tunneled through ssh
+	sshClientHost = "http://docker.example.com"
+)
+
+// isRemote is true when the engine is on another machine, so paths of this machine can not be bind mounted
+func isRemote(host string) bool {
+	u, err := url.Parse(host)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "tcp", "http", "https", "ssh":
+	default:
+		return false
+	}
+	if u.Hostname() == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip == nil || !ip.IsLoopback()
+}
+
+// sshDialer tunnels the engine api through `ssh host docker system dial-stdio` like the docker cli does,
+// keys and known hosts come from the ssh config of the user
+func sshDialer(host string) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, errors.Errorf("no host in %s", host)
+	}
+	args := make([]string, 0)
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// the connection outlives the dial, so the command is not bound to ctx
+		return newCommandConn(exec.Command("ssh", args...))
+	}, nil
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a command
+type commandConn struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.ReadCloser
+	closeOnce sync.Once
+}
+
+func newCommandConn(cmd *exec.Cmd) (net.Conn, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "start %s", cmd.Path)
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (c *commandConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *commandConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.stdin.Close()
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return dummyAddr{}
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return dummyAddr{}
+}
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type dummyAddr struct{}
+
+func (d dummyAddr) Network() string {
+	return "command"
+}
+
+func (d dummyAddr) String() string {
+	return "command"
+}
@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"io"
+	"os/exec"
+	"testing"
+)
+
+func TestIsRemote(t *testing.T) {
+	for host, remote := range map[string]bool{
+		"unix:///var/run/docker.sock": false,
+		"tcp://127.0.0.1:2375":        false,
+		"tcp://localhost:2375":        false,
+		"tcp://10.0.0.2:2376":         true,
+		"ssh://ci@docker-host":        true,
+	} {
+		if isRemote(host) != remote {
+			t.Fatalf("%s should be remote: %t", host, remote)
+		}
+	}
+}
+
+func TestCommandConn(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat is not found")
+	}
+	conn, err := newCommandConn(exec.Command("cat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo: %s %v", buf, err)
+	}
+}
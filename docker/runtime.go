@@ -0,0 +1,60 @@
+package docker
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"io"
+)
+
+// Runtime is the container engine the compose runs on, DockerProvider talks to the docker daemon
+// and the fake package keeps everything in memory for tests.
+// Images are pulled on container creation, exec, logs and file copies are done through Container
+type Runtime interface {
+	Health(ctx context.Context) error
+	Capabilities() Capabilities
+	GetDefaultNetwork() string
+
+	CreateContainer(ctx context.Context, req ContainerRequest, sessionId string, autoLabel bool) (Container, error)
+	CreateContainerAutoLabel(ctx context.Context, req ContainerRequest, sessionId string) (Container, error)
+	RunContainer(ctx context.Context, req ContainerRequest, sessionId string) (Container, error)
+	RemoveContainer(ctx context.Context, id string) error
+	FindAllPodContainers(ctx context.Context) ([]types.Container, error)
+	FindAllContainersWithSessionId(ctx context.Context, sessionId string) ([]types.Container, error)
+	FindContainers(ctx context.Context, sessionId string) ([]types.Container, error)
+	FindContainerByName(ctx context.Context, name string) (*types.Container, error)
+	State(ctx context.Context, id string) (*types.ContainerState, error)
+	ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error)
+	ContainerStats(ctx context.Context, id string) (types.ContainerStats, error)
+	ContainerEvents(ctx context.Context, sessionId string, since string, actions ...string) (<-chan events.Message, <-chan error)
+
+	CreateNetwork(ctx context.Context, req NetworkRequest, sessionId string) (Network, error)
+	GetNetwork(ctx context.Context, req NetworkRequest) (types.NetworkResource, error)
+	RemoveNetwork(ctx context.Context, networkID string) error
+	FindAllNetworks(ctx context.Context) ([]types.NetworkResource, error)
+
+	CreateVolume(ctx context.Context, name string, sessionId string, volumeGroup string) (types.Volume, error)
+	RemoveVolume(ctx context.Context, volumeName string, sessionId string, force bool) error
+	FindAllVolumes(ctx context.Context) ([]*types.Volume, error)
+	FindAllVolumesWithSessionId(ctx context.Context, sessionId string) ([]*types.Volume, error)
+	// CopyToVolume extracts a tar archive into the volume
+	CopyToVolume(ctx context.Context, volumeName string, sessionId string, archive io.Reader) error
+
+	// FindCacheVolume returns nil when there is no cache volume of the content hash
+	FindCacheVolume(ctx context.Context, hash string) (*types.Volume, error)
+	// CreateCacheVolume fills a new cache volume of the content hash with the archive, see CacheVolumeLabel
+	CreateCacheVolume(ctx context.Context, hash string, source string, sessionId string, archive io.Reader) (types.Volume, error)
+	FindAllCacheVolumes(ctx context.Context) ([]*types.Volume, error)
+	RemoveCacheVolume(ctx context.Context, name string) error
+	// CloneVolume copies the files of the from volume, e.g. a cache volume, into the volume of the session
+	CloneVolume(ctx context.Context, from string, volumeName string, sessionId string) error
+	// ExportVolume streams the files of the volume as a tar archive
+	ExportVolume(ctx context.Context, volumeName string, sessionId string) (io.ReadCloser, error)
+	// CreateSnapshotVolume creates the empty volume of the snapshot of the volume, see SnapshotLabel
+	CreateSnapshotVolume(ctx context.Context, volumeName string, snapshot string, sessionId string) (types.Volume, error)
+
+	// ClearWithSession removes every container, volume and network of the session
+	ClearWithSession(ctx context.Context, sessionId string)
+}
+
+var _ Runtime = (*DockerProvider)(nil)
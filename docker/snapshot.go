@@ -0,0 +1,32 @@
+package docker
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/volume"
+)
+
+const (
+	// SnapshotLabel is the name of the snapshot a snapshot volume holds, SnapshotVolumeLabel the volume it was taken of,
+	// snapshot volumes belong to the session and are removed with it
+	SnapshotLabel       = "tpc.snapshot"
+	SnapshotVolumeLabel = "tpc.snapshot.volume"
+)
+
+// SnapshotVolumeName is the name of the snapshot volume without the session suffix
+func SnapshotVolumeName(volumeName string, snapshot string) string {
+	return volumeName + "_snapshot_" + snapshot
+}
+
+func (p *DockerProvider) CreateSnapshotVolume(ctx context.Context, volumeName string, snapshot string, sessionId string) (types.Volume, error) {
+	return p.client.VolumeCreate(ctx, volume.VolumeCreateBody{
+		Driver: "local",
+		Name:   SnapshotVolumeName(volumeName, snapshot) + "_" + sessionId,
+		Labels: map[string]string{
+			PodContainerLabel:   "true",
+			ComposeSessionID:    sessionId,
+			SnapshotLabel:       snapshot,
+			SnapshotVolumeLabel: volumeName,
+		},
+	})
+}
@@ -0,0 +1,211 @@
+package docker
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveSourceExts are the archive files a volume can be seeded from besides a directory
+var archiveSourceExts = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// IsArchiveSource is true when the name is a .tar, .tar.gz, .tgz or .zip file
+func IsArchiveSource(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range archiveSourceExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ArchiveSource streams src as a tar archive with the overrides of options, src is a directory archived
+// like ArchiveDirWithOptions or an archive file whose entries are rewritten, entries escaping the root
+// through .. , an absolute path or a symlink of the archive fail the stream
+func ArchiveSource(src string, options ArchiveOptions) io.ReadCloser {
+	if !IsArchiveSource(src) {
+		return ArchiveDirWithOptions(src, options)
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeSource(writer, src, options, false))
+	}()
+	return reader
+}
+
+func writeSource(w io.Writer, src string, options ArchiveOptions, normalize bool) error {
+	if !IsArchiveSource(src) {
+		return writeArchive(w, src, options, normalize)
+	}
+	if options.Symlinks == SymlinkFollow {
+		return errors.Errorf("symlinks of the archive %s can not be followed", src)
+	}
+	a := &archiver{
+		tw:        tar.NewWriter(w),
+		options:   options,
+		normalize: normalize,
+	}
+	e := &extractor{archiver: a, links: make(map[string]bool), parents: make(map[string]bool)}
+	var err error
+	if strings.HasSuffix(strings.ToLower(src), ".zip") {
+		err = e.copyZip(src)
+	} else {
+		err = e.copyTarFile(src)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "archive %s", src)
+	}
+	return a.tw.Close()
+}
+
+// extractor rewrites the entries of an archive file, links and parents are the symlinks and the parent
+// directories of the entries so far, nothing may be written through a symlink
+type extractor struct {
+	*archiver
+	links   map[string]bool
+	parents map[string]bool
+}
+
+func (e *extractor) copyTarFile(src string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if !strings.HasSuffix(strings.ToLower(src), ".tar") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+		default:
+			// devices and fifos have no place in a volume
+			continue
+		}
+		entry := &tar.Header{
+			Typeflag: hdr.Typeflag,
+			Name:     hdr.Name,
+			Linkname: hdr.Linkname,
+			Size:     hdr.Size,
+			Mode:     hdr.Mode,
+			Uid:      hdr.Uid,
+			Gid:      hdr.Gid,
+			Uname:    hdr.Uname,
+			Gname:    hdr.Gname,
+			ModTime:  hdr.ModTime,
+		}
+		if err = e.copy(entry, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *extractor) copyZip(src string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		mode := f.Mode()
+		entry := &tar.Header{Name: f.Name, Mode: int64(mode.Perm()), ModTime: f.Modified}
+		switch {
+		case mode.IsDir():
+			entry.Typeflag = tar.TypeDir
+		case mode&os.ModeSymlink != 0:
+			entry.Typeflag = tar.TypeSymlink
+		case mode.IsRegular():
+			entry.Typeflag = tar.TypeReg
+			entry.Size = int64(f.UncompressedSize64)
+		default:
+			continue
+		}
+		if err = e.copyZipFile(f, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extractor) copyZipFile(f *zip.File, entry *tar.Header) error {
+	content, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	if entry.Typeflag == tar.TypeSymlink {
+		// the target of a symlink is its content
+		target, err := io.ReadAll(io.LimitReader(content, 4096))
+		if err != nil {
+			return err
+		}
+		entry.Linkname = string(target)
+	}
+	return e.copy(entry, content)
+}
+
+// copy checks the entry stays in the root and writes it
+func (e *extractor) copy(entry *tar.Header, content io.Reader) error {
+	name, err := entryName(entry.Name)
+	if err != nil || name == "" {
+		return err
+	}
+	if entry.Typeflag == tar.TypeLink {
+		if entry.Linkname, err = entryName(entry.Linkname); err != nil {
+			return err
+		}
+	}
+	for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+		if e.links[parent] {
+			return errors.Errorf("entry %s is written through the symlink %s", entry.Name, parent)
+		}
+		e.parents[parent] = true
+	}
+	if entry.Typeflag == tar.TypeSymlink {
+		if e.options.Symlinks == SymlinkSkip {
+			return nil
+		}
+		if e.parents[name] {
+			return errors.Errorf("symlink %s replaces a directory of the archive", entry.Name)
+		}
+		e.links[name] = true
+	}
+	entry.Name = name
+	if entry.Typeflag == tar.TypeDir {
+		entry.Name += "/"
+		e.parents[name] = true
+	}
+	return e.add(entry, content)
+}
+
+// entryName is the cleaned path of an archive entry, empty for the root, paths outside of the root fail
+func entryName(name string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.Errorf("entry %s is outside of the archive root", name)
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
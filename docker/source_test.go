@@ -0,0 +1,130 @@
+package docker
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entry is a tar entry of writeTarGz, the content is set for regular files
+type entry struct {
+	hdr     *tar.Header
+	content string
+}
+
+func file(name string, content string) entry {
+	return entry{hdr: &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(content))}, content: content}
+}
+
+func header(hdr *tar.Header) entry {
+	return entry{hdr: hdr}
+}
+
+func writeTarGz(t *testing.T, name string, entries ...entry) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		if err = tw.WriteHeader(e.hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveSource(t *testing.T) {
+	dir := t.TempDir()
+	tgz := filepath.Join(dir, "fixtures.tgz")
+	writeTarGz(t, tgz,
+		header(&tar.Header{Typeflag: tar.TypeDir, Name: "./sql/", Mode: 0755}),
+		file("./sql/init.sql", "select 1;"),
+		header(&tar.Header{Typeflag: tar.TypeSymlink, Name: "init.sql", Linkname: "sql/init.sql"}),
+		header(&tar.Header{Typeflag: tar.TypeChar, Name: "null"}),
+	)
+	headers, contents := readArchive(t, ArchiveSource(tgz, ArchiveOptions{Owner: &Owner{Uid: 999, Gid: 999}, Mode: 0600}))
+	if len(headers) != 3 || contents["sql/init.sql"] != "select 1;" || headers["sql/"] == nil {
+		t.Fatalf("unexpected entries: %v", headers)
+	}
+	if hdr := headers["sql/init.sql"]; hdr.Uid != 999 || hdr.Mode != 0600 {
+		t.Fatalf("options should be applied: %+v", hdr)
+	}
+	if hdr := headers["init.sql"]; hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "sql/init.sql" {
+		t.Fatalf("symlink should be kept: %+v", hdr)
+	}
+	headers, _ = readArchive(t, ArchiveSource(tgz, ArchiveOptions{Symlinks: SymlinkSkip}))
+	if _, ok := headers["init.sql"]; ok {
+		t.Fatal("symlink should be skipped")
+	}
+
+	zipName := filepath.Join(dir, "fixtures.zip")
+	zipFile, err := os.Create(zipName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zipFile)
+	w, err := zw.Create("sql/init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("select 1;"))
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_ = zipFile.Close()
+	_, contents = readArchive(t, ArchiveSource(zipName, ArchiveOptions{}))
+	if contents["sql/init.sql"] != "select 1;" {
+		t.Fatalf("unexpected zip entries: %v", contents)
+	}
+	tgzHash, err := HashSource(tgz, ArchiveOptions{Symlinks: SymlinkSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipHash, err := HashSource(zipName, ArchiveOptions{})
+	if err != nil || tgzHash == zipHash {
+		t.Fatalf("different archives should have different hashes: %s %v", zipHash, err)
+	}
+}
+
+func TestArchiveSourceTraversal(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string][]entry{
+		"parent":   {file("../evil", "x")},
+		"absolute": {file("/etc/evil", "x")},
+		"nested":   {file("data/../../evil", "x")},
+		"hardlink": {header(&tar.Header{Typeflag: tar.TypeLink, Name: "passwd", Linkname: "../../etc/passwd"})},
+		"symlink": {
+			header(&tar.Header{Typeflag: tar.TypeSymlink, Name: "etc", Linkname: "/etc"}),
+			file("etc/evil", "x"),
+		},
+	}
+	for name, entries := range cases {
+		tarName := filepath.Join(dir, name+".tar.gz")
+		writeTarGz(t, tarName, entries...)
+		archive := ArchiveSource(tarName, ArchiveOptions{})
+		_, err := io.Copy(io.Discard, archive)
+		_ = archive.Close()
+		if err == nil || !strings.Contains(err.Error(), name+".tar.gz") {
+			t.Fatalf("%s should fail the archive: %v", name, err)
+		}
+	}
+	if !IsArchiveSource("data/FIXTURES.TAR.GZ") || IsArchiveSource("data/init.sql") {
+		t.Fatal("unexpected archive source")
+	}
+}
@@ -3,6 +3,7 @@ package wait
 import (
 	"context"
 	"fmt"
+	"podcompose/trace"
 	"time"
 )
 
@@ -38,7 +39,9 @@ func (ms *MultiStrategy) WaitUntilReady(ctx context.Context, target StrategyTarg
 	}
 
 	for _, strategy := range ms.Strategies {
-		err := strategy.WaitUntilReady(ctx, target)
+		strategyCtx, span := trace.Start(ctx, "wait_strategy")
+		err := strategy.WaitUntilReady(strategyCtx, target)
+		span.SetAttribute("wait.strategy", fmt.Sprintf("%T", strategy)).Finish(err)
 		if err != nil {
 			return err
 		}
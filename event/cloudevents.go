@@ -0,0 +1,138 @@
+package event
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+const FormatCloudEvents = "cloudevents"
+const CloudEventsSpecVersion = "1.0"
+const CloudEventsContentType = "application/cloudevents+json"
+const CloudEventsBatchContentType = "application/cloudevents-batch+json"
+
+// CloudEvent is the CloudEvents 1.0 structured json encoding of an EventMsg,
+// Topic, Seq and OperationId are extension attributes so that the EventMsg can be decoded back
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	Id              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            *time.Time      `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Topic           string          `json:"topic"`
+	Seq             uint64          `json:"seq,omitempty"`
+	OperationId     string          `json:"operationid,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// ToCloudEvent encodes the message as a CloudEvent, source is the session id of the bus
+func (e *EventMsg) ToCloudEvent(source string) (*CloudEvent, error) {
+	payload := e.Payload()
+	if payload == nil {
+		return nil, errors.Errorf("event message %d has no payload", e.Seq)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cloudEvent := &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		Id:              strconv.FormatUint(e.Seq, 10),
+		Source:          source,
+		Type:            e.Type(),
+		Subject:         e.subject(),
+		DataContentType: "application/json",
+		Topic:           e.Topic,
+		Seq:             e.Seq,
+		OperationId:     e.OperationId,
+		Data:            data,
+	}
+	var eventTime struct {
+		EventTime time.Time
+	}
+	if err = json.Unmarshal(data, &eventTime); err == nil && !eventTime.EventTime.IsZero() {
+		cloudEvent.Time = &eventTime.EventTime
+	}
+	return cloudEvent, nil
+}
+
+// subject is the pod, the container, the task or the volume the event is about
+func (e *EventMsg) subject() string {
+	switch {
+	case e.PodEventData != nil:
+		return e.PodEventData.Name
+	case e.ContainerEventData != nil:
+		if e.ContainerEventData.PodName == "" {
+			return e.ContainerEventData.Name
+		}
+		return e.ContainerEventData.PodName + "/" + e.ContainerEventData.ContainerName
+	case e.TaskGroupEventData != nil:
+		return e.TaskGroupEventData.TaskGroupName
+	case e.TaskEventData != nil:
+		return e.TaskEventData.TaskGroupName + "/" + e.TaskEventData.TaskName
+	case e.VolumeEventData != nil:
+		return e.VolumeEventData.Name
+	}
+	return ""
+}
+
+// ToEventMsg decodes the data into the payload field of the topic
+func (c *CloudEvent) ToEventMsg() (*EventMsg, error) {
+	eventMsg := &EventMsg{
+		Seq:         c.Seq,
+		Topic:       c.Topic,
+		OperationId: c.OperationId,
+	}
+	var payload interface{}
+	switch c.Topic {
+	case Compose:
+		eventMsg.ComposeEventData = &ComposeEventData{}
+		payload = eventMsg.ComposeEventData
+	case Pod:
+		eventMsg.PodEventData = &PodEventData{}
+		payload = eventMsg.PodEventData
+	case Container:
+		eventMsg.ContainerEventData = &ContainerEventData{}
+		payload = eventMsg.ContainerEventData
+	case TaskGroup:
+		eventMsg.TaskGroupEventData = &TaskGroupEventData{}
+		payload = eventMsg.TaskGroupEventData
+	case Task:
+		eventMsg.TaskEventData = &TaskEventData{}
+		payload = eventMsg.TaskEventData
+	case Ingress:
+		eventMsg.IngressEventData = &IngressEventData{}
+		payload = eventMsg.IngressEventData
+	case Stats:
+		eventMsg.StatsEventData = &StatsEventData{}
+		payload = eventMsg.StatsEventData
+	case Volume:
+		eventMsg.VolumeEventData = &VolumeEventData{}
+		payload = eventMsg.VolumeEventData
+	case Error:
+		eventMsg.ErrorData = &ErrorData{}
+		payload = eventMsg.ErrorData
+	default:
+		return nil, errors.Errorf("unknown topic %s", c.Topic)
+	}
+	if err := json.Unmarshal(c.Data, payload); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return eventMsg, nil
+}
+
+// EncodeCloudEvent converts EventMsg json, e.g. the data of a Record, to CloudEvent json
+func EncodeCloudEvent(data []byte, source string) ([]byte, error) {
+	var eventMsg EventMsg
+	if err := json.Unmarshal(data, &eventMsg); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cloudEvent, err := eventMsg.ToCloudEvent(source)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(cloudEvent)
+}
@@ -0,0 +1,50 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCloudEvent(t *testing.T) {
+	eventMsg := (&ContainerEventData{
+		Type:          ContainerEventReadyType,
+		PodName:       "mysql",
+		ContainerName: "db",
+		EventTime:     time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	}).ToMessage()
+	eventMsg.Seq = 7
+	cloudEvent, err := eventMsg.ToCloudEvent("session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cloudEvent.SpecVersion != CloudEventsSpecVersion || cloudEvent.Id != "7" || cloudEvent.Source != "session" ||
+		cloudEvent.Type != ContainerEventReadyType || cloudEvent.Subject != "mysql/db" || !cloudEvent.Time.Equal(eventMsg.ContainerEventData.EventTime) {
+		t.Fatalf("unexpected cloud event: %+v", cloudEvent)
+	}
+	var attributes map[string]interface{}
+	data, _ := json.Marshal(cloudEvent)
+	if err = json.Unmarshal(data, &attributes); err != nil {
+		t.Fatal(err)
+	}
+	if attributes["specversion"] != "1.0" || attributes["data"].(map[string]interface{})["PodName"] != "mysql" {
+		t.Fatalf("unexpected cloud event json: %s", string(data))
+	}
+
+	decoded, err := decodeMessage(encodeMessage(Container, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Seq != 7 || decoded.ContainerEventData == nil || decoded.ContainerEventData.ContainerName != "db" {
+		t.Fatalf("unexpected decoded message: %s", decoded.ToJson())
+	}
+
+	errorMsg := (&ErrorData{Reason: "die"}).ToMessage()
+	data, err = EncodeCloudEvent([]byte(errorMsg.ToJson()), "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &attributes); err != nil || attributes["type"] != Error {
+		t.Fatalf("unexpected cloud event json: %s", string(data))
+	}
+}
@@ -9,47 +9,153 @@ import (
 	_ "go.nanomsg.org/mangos/v3/transport/all"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
+	"os"
 	"podcompose/common"
+	"podcompose/metrics"
+	"sync"
 	"time"
 )
 
 var Bus *EventBus
 
 type EventBus struct {
-	sock mangos.Socket
+	sock          mangos.Socket
+	lock          sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	seq           uint64
+	history       []*Record
+	historyFile   *os.File
+	// cloudEventsSource is the CloudEvents source of the socket messages, they are EventMsg json when empty
+	cloudEventsSource string
+}
+
+func newEventBus(sock mangos.Socket) *EventBus {
+	return &EventBus{
+		sock:          sock,
+		subscriptions: make(map[*Subscription]struct{}),
+	}
 }
 
 type EventMsg struct {
-	Topic              string
+	// Seq numbers the messages of the bus from 1, it is 0 when the event is not sent by the bus
+	Seq   uint64
+	Topic string
+	// OperationId links the event to the api call or the task group that caused it
+	OperationId        string
 	ComposeEventData   *ComposeEventData
 	PodEventData       *PodEventData
 	ContainerEventData *ContainerEventData
 	TaskGroupEventData *TaskGroupEventData
 	TaskEventData      *TaskEventData
 	IngressEventData   *IngressEventData
+	StatsEventData     *StatsEventData
+	VolumeEventData    *VolumeEventData
 	ErrorData          *ErrorData
 }
 
+// Type returns the type of the payload, error messages have the Error type
+func (e *EventMsg) Type() string {
+	switch {
+	case e.ComposeEventData != nil:
+		return e.ComposeEventData.Type
+	case e.PodEventData != nil:
+		return e.PodEventData.Type
+	case e.ContainerEventData != nil:
+		return e.ContainerEventData.Type
+	case e.TaskGroupEventData != nil:
+		return e.TaskGroupEventData.Type
+	case e.TaskEventData != nil:
+		return e.TaskEventData.Type
+	case e.IngressEventData != nil:
+		return e.IngressEventData.Type
+	case e.StatsEventData != nil:
+		return e.StatsEventData.Type
+	case e.VolumeEventData != nil:
+		return e.VolumeEventData.Type
+	case e.ErrorData != nil:
+		return Error
+	}
+	return ""
+}
+
 func (e *EventMsg) ToJson() string {
 	jsonbody, _ := json.Marshal(e)
 	return string(jsonbody)
 }
-func (e *EventBus) Publish(event Event) error {
+func (e *EventBus) Publish(ctx context.Context, event Event) error {
 	eventMsg := event.ToMessage()
-	return e.sock.Send([]byte(eventMsg.ToJson()))
+	eventMsg.OperationId = OperationId(ctx)
+	// the lock keeps the sequence order on the socket, in the history and in the subscriptions
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.seq++
+	eventMsg.Seq = e.seq
+	record := &Record{Seq: eventMsg.Seq, Topic: eventMsg.Topic, OperationId: eventMsg.OperationId, Data: []byte(eventMsg.ToJson())}
+	e.record(record)
+	e.dispatch(record)
+	data := record.Data
+	if e.cloudEventsSource != "" {
+		cloudEvent, err := eventMsg.ToCloudEvent(e.cloudEventsSource)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(cloudEvent); err != nil {
+			return err
+		}
+	}
+	return e.sock.Send(encodeMessage(record.Topic, data))
+}
+
+// UseCloudEvents sends the socket messages as CloudEvents of the source, the history and
+// the local subscriptions keep the EventMsg json
+func (e *EventBus) UseCloudEvents(source string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.cloudEventsSource = source
+}
+
+// CloudEventsSource is the source of UseCloudEvents, empty when the socket messages are EventMsg json
+func (e *EventBus) CloudEventsSource() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.cloudEventsSource
 }
 
 func StartEventBusServer() error {
-	var sock mangos.Socket
-	var err error
-	if sock, err = pub.NewSocket(); err != nil {
-		return err
+	_, err := ListenEventBus(fmt.Sprintf("tcp://0.0.0.0:%s", common.ServerAgentEventBusPort))
+	return err
+}
+
+// ListenEventBus starts Bus on the address and returns the bound one, port 0 picks a free port
+func ListenEventBus(addr string) (string, error) {
+	sock, err := pub.NewSocket()
+	if err != nil {
+		return "", err
+	}
+	listener, err := sock.NewListener(addr, nil)
+	if err != nil {
+		return "", err
 	}
-	if err = sock.Listen(fmt.Sprintf("tcp://0.0.0.0:%s", common.ServerAgentEventBusPort)); err != nil {
-		return err
+	if err = listener.Listen(); err != nil {
+		return "", err
 	}
-	Bus = &EventBus{sock: sock}
-	return nil
+	Bus = newEventBus(sock)
+	return listener.Address(), nil
+}
+
+// Close closes the socket, the history file and the subscriptions of the bus
+func (e *EventBus) Close() error {
+	e.lock.Lock()
+	for subscription := range e.subscriptions {
+		delete(e.subscriptions, subscription)
+		close(subscription.ch)
+	}
+	if e.historyFile != nil {
+		_ = e.historyFile.Close()
+		e.historyFile = nil
+	}
+	e.lock.Unlock()
+	return e.sock.Close()
 }
 
 const Compose string = "compose"
@@ -88,19 +194,37 @@ const ContainerEventStartType = "container_event_container_start"
 const ContainerEventReadyType = "container_event_container_ready"
 const ContainerEventRemoveType = "container_event_container_remove"
 const ContainerEventStateType = "container_event_container_state"
+const ContainerEventDieType = "container_event_container_die"
+const ContainerEventOOMType = "container_event_container_oom"
+const ContainerEventHealthType = "container_event_container_health_status"
+const ContainerEventDestroyType = "container_event_container_destroy"
 
 const Ingress = "ingress"
 const IngressEventChange = "ingress_event_change"
 
-func Publish(event Event) {
+const Stats = "stats"
+const StatsEventUsage = "stats_event_usage"
+
+const Volume = "volume"
+const VolumeEventSeedStart = "volume_event_seed_start"
+const VolumeEventSeedProgress = "volume_event_seed_progress"
+const VolumeEventSeedSuccess = "volume_event_seed_success"
+const VolumeEventSeedFail = "volume_event_seed_fail"
+
+// VolumeEventSeedCached is sent instead of the start and progress when the volume is seeded from an existing cache volume
+const VolumeEventSeedCached = "volume_event_seed_cached"
+
+// Publish sends the event to the bus and runs its Do, the operation id of ctx is set on the message
+func Publish(ctx context.Context, event Event) {
 	event.SetEventTime(time.Now())
 	if Bus != nil {
-		err := Bus.Publish(event)
+		err := Bus.Publish(ctx, event)
 		if err != nil {
+			metrics.EventBusPublishErrors.WithLabelValues(event.Topic()).Inc()
 			zap.L().Sugar().Errorf("send event error")
 		}
 	}
-	zap.L().Sugar().Debugf("event[%s]: %s", event.Topic(), event.ToMessage().ToJson())
+	zap.L().Sugar().Debugf("event[%s] operation[%s]: %s", event.Topic(), OperationId(ctx), event.ToMessage().ToJson())
 	err := event.Do()
 	if err != nil {
 		zap.L().Sugar().Errorf("event %s do error %s", event.ToMessage().ToJson(), err)
@@ -298,3 +422,59 @@ func (t *IngressEventData) Topic() string {
 func (t *IngressEventData) Do() error {
 	return nil
 }
+
+type StatsEventData struct {
+	Type      string
+	PodStats  []common.PodStats
+	EventTime time.Time
+}
+
+func (s *StatsEventData) SetEventTime(eventTime time.Time) {
+	s.EventTime = eventTime
+}
+
+func (s *StatsEventData) ToMessage() *EventMsg {
+	return &EventMsg{
+		Topic:          s.Topic(),
+		StatsEventData: s,
+	}
+}
+
+func (s *StatsEventData) Topic() string {
+	return Stats
+}
+
+func (s *StatsEventData) Do() error {
+	return nil
+}
+
+// VolumeEventData reports the seeding of a volume, Files and Bytes are copied so far,
+// Cache is the cache volume the data comes from when the volume is cached
+type VolumeEventData struct {
+	Type      string
+	Name      string
+	Files     int
+	Bytes     int64
+	Error     string
+	Cache     string
+	EventTime time.Time
+}
+
+func (v *VolumeEventData) SetEventTime(eventTime time.Time) {
+	v.EventTime = eventTime
+}
+
+func (v *VolumeEventData) ToMessage() *EventMsg {
+	return &EventMsg{
+		Topic:           v.Topic(),
+		VolumeEventData: v,
+	}
+}
+
+func (v *VolumeEventData) Topic() string {
+	return Volume
+}
+
+func (v *VolumeEventData) Do() error {
+	return nil
+}
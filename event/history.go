@@ -0,0 +1,63 @@
+package event
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+)
+
+// historySize bounds the number of records kept in memory, the persisted history is not bounded
+const historySize = 1024
+
+// PersistHistory appends every published EventMsg as a json line to the file
+func (e *EventBus) PersistHistory(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0766)
+	if err != nil {
+		return err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.historyFile = file
+	return nil
+}
+
+// History returns the kept records whose sequence is greater than since
+func (e *EventBus) History(since uint64, topics ...string) []*Record {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	filter := make(map[string]bool)
+	for _, topic := range topics {
+		filter[topic] = true
+	}
+	result := make([]*Record, 0)
+	for _, record := range e.historySince(since) {
+		if len(filter) == 0 || filter[record.Topic] {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// historySince is called with the lock held
+func (e *EventBus) historySince(since uint64) []*Record {
+	for i, record := range e.history {
+		if record.Seq > since {
+			return e.history[i:]
+		}
+	}
+	return nil
+}
+
+// record is called with the lock held
+func (e *EventBus) record(record *Record) {
+	if len(e.history) >= historySize {
+		e.history = e.history[len(e.history)-historySize+1:]
+	}
+	e.history = append(e.history, record)
+	if e.historyFile == nil {
+		return
+	}
+	if _, err := fmt.Fprintf(e.historyFile, "%s\n", record.Data); err != nil {
+		zap.L().Sugar().Errorf("persist event history error: %s", err)
+	}
+}
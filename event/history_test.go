@@ -0,0 +1,70 @@
+package event
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"go.nanomsg.org/mangos/v3/protocol/pub"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	sock, err := pub.NewSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sock.Close()
+	bus := newEventBus(sock)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := bus.PersistHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < historySize+10; i++ {
+		if err := bus.Publish(context.Background(), &PodEventData{Name: "nginx", Type: PodEventStartType}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bus.Publish(context.Background(), &IngressEventData{Type: IngressEventChange}); err != nil {
+		t.Fatal(err)
+	}
+
+	if history := bus.History(0); len(history) != historySize {
+		t.Fatalf("history is not bounded: %d", len(history))
+	}
+	history := bus.History(historySize+9, Pod)
+	if len(history) != 1 {
+		t.Fatalf("expect 1 pod event, got %d", len(history))
+	}
+	var eventMsg EventMsg
+	if err := json.Unmarshal(history[0].Data, &eventMsg); err != nil {
+		t.Fatal(err)
+	}
+	if eventMsg.Seq != historySize+10 {
+		t.Fatalf("unexpected sequence: %d", eventMsg.Seq)
+	}
+
+	subscription := bus.SubscribeFrom(historySize + 9)
+	defer subscription.Close()
+	if len(subscription.C) != 2 {
+		t.Fatalf("expect 2 replayed records, got %d", len(subscription.C))
+	}
+	if record := <-subscription.C; record.Seq != historySize+10 {
+		t.Fatalf("unexpected replayed record: %d", record.Seq)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	if lines != historySize+11 {
+		t.Fatalf("expect %d persisted events, got %d", historySize+11, lines)
+	}
+}
@@ -0,0 +1,33 @@
+package event
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// OperationIdHeader carries the operation id of an agent api call in the request and the response
+const OperationIdHeader = "X-Operation-Id"
+
+type operationIdKey struct{}
+
+// NewOperationId returns a random id for an api call or an auto triggered task group
+func NewOperationId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithOperationId returns a context whose published events are linked to the operation
+func WithOperationId(ctx context.Context, operationId string) context.Context {
+	return context.WithValue(ctx, operationIdKey{}, operationId)
+}
+
+// OperationId returns the operation id of ctx, empty when the context is not part of an operation
+func OperationId(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	operationId, _ := ctx.Value(operationIdKey{}).(string)
+	return operationId
+}
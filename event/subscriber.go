@@ -0,0 +1,134 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go.nanomsg.org/mangos/v3"
+	"go.nanomsg.org/mangos/v3/protocol/sub"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// topicSeparator ends the topic prefix of a bus message, the rest of the message is the EventMsg json
+const topicSeparator = ' '
+
+const subscriberReconnectTime = 100 * time.Millisecond
+const subscriberMaxReconnectTime = 5 * time.Second
+
+// encodeMessage prefixes the EventMsg json with its topic so that SUB sockets can filter on the topic
+func encodeMessage(topic string, data []byte) []byte {
+	msg := make([]byte, 0, len(topic)+1+len(data))
+	msg = append(msg, topic...)
+	msg = append(msg, topicSeparator)
+	return append(msg, data...)
+}
+
+func decodeMessage(msg []byte) (*EventMsg, error) {
+	index := bytes.IndexByte(msg, topicSeparator)
+	if index < 0 {
+		return nil, errors.Errorf("message without topic: %s", string(msg))
+	}
+	data := msg[index+1:]
+	var cloudEvent CloudEvent
+	if err := json.Unmarshal(data, &cloudEvent); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if cloudEvent.SpecVersion != "" {
+		return cloudEvent.ToEventMsg()
+	}
+	var eventMsg EventMsg
+	if err := json.Unmarshal(data, &eventMsg); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &eventMsg, nil
+}
+
+// Subscribe dials the event bus at addr, e.g. localhost:7070 or tcp://localhost:7070, and delivers the
+// decoded messages of the given topics, every topic is subscribed when none is given.
+// Both EventMsg and CloudEvents messages are decoded to EventMsg.
+// The bus is dialed again when the connection is lost, the channel is closed when ctx is done
+func Subscribe(ctx context.Context, addr string, topics ...string) (<-chan *EventMsg, error) {
+	sock, err := sub.NewSocket()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(topics) == 0 {
+		topics = []string{""}
+	}
+	for _, topic := range topics {
+		prefix := []byte{}
+		if topic != "" {
+			prefix = encodeMessage(topic, nil)
+		}
+		if err = sock.SetOption(mangos.OptionSubscribe, prefix); err != nil {
+			_ = sock.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "tcp://" + addr
+	}
+	err = sock.DialOptions(addr, map[string]interface{}{
+		mangos.OptionDialAsynch:       true,
+		mangos.OptionReconnectTime:    subscriberReconnectTime,
+		mangos.OptionMaxReconnectTime: subscriberMaxReconnectTime,
+	})
+	if err != nil {
+		_ = sock.Close()
+		return nil, errors.WithStack(err)
+	}
+	ch := make(chan *EventMsg, subscriptionBufferSize)
+	go func() {
+		<-ctx.Done()
+		_ = sock.Close()
+	}()
+	go func() {
+		defer close(ch)
+		for {
+			msg, err := sock.Recv()
+			if err != nil {
+				// Recv only fails when the socket is closed
+				return
+			}
+			eventMsg, err := decodeMessage(msg)
+			if err != nil {
+				zap.L().Sugar().Warnf("decode event error: %s", err)
+				continue
+			}
+			select {
+			case ch <- eventMsg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Payload returns the typed event carried by the message, nil when the message is empty
+func (e *EventMsg) Payload() Event {
+	switch {
+	case e.ComposeEventData != nil:
+		return e.ComposeEventData
+	case e.PodEventData != nil:
+		return e.PodEventData
+	case e.ContainerEventData != nil:
+		return e.ContainerEventData
+	case e.TaskGroupEventData != nil:
+		return e.TaskGroupEventData
+	case e.TaskEventData != nil:
+		return e.TaskEventData
+	case e.IngressEventData != nil:
+		return e.IngressEventData
+	case e.StatsEventData != nil:
+		return e.StatsEventData
+	case e.VolumeEventData != nil:
+		return e.VolumeEventData
+	case e.ErrorData != nil:
+		return e.ErrorData
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package event
+
+import (
+	"context"
+	"go.nanomsg.org/mangos/v3/protocol/pub"
+	"net"
+	"testing"
+	"time"
+)
+
+func listenBus(t *testing.T, addr string) *EventBus {
+	sock, err := pub.NewSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sock.Listen("tcp://" + addr); err != nil {
+		t.Fatal(err)
+	}
+	return newEventBus(sock)
+}
+
+// receive publishes until the subscriber gets a message, the subscriber connects asynchronously
+func receive(t *testing.T, bus *EventBus, ch <-chan *EventMsg, events ...Event) *EventMsg {
+	timeout := time.After(10 * time.Second)
+	for {
+		for _, e := range events {
+			if err := bus.Publish(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		select {
+		case eventMsg := <-ch:
+			return eventMsg
+		case <-time.After(50 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("no event received")
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+	bus := listenBus(t, addr)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := Subscribe(ctx, addr, Task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventMsg := receive(t, bus, ch, &TaskGroupEventData{Type: TaskGroupEventTaskGroupStart}, &TaskEventData{Type: TaskEventTaskStart})
+	taskEvent, ok := eventMsg.Payload().(*TaskEventData)
+	if !ok || taskEvent.Type != TaskEventTaskStart {
+		t.Fatalf("unexpected event: %s", eventMsg.ToJson())
+	}
+
+	// the subscriber dials again when the bus comes back
+	_ = bus.sock.Close()
+	bus = listenBus(t, addr)
+	defer bus.sock.Close()
+	eventMsg = receive(t, bus, ch, &TaskEventData{Type: TaskEventTaskSuccess})
+	if eventMsg.TaskEventData == nil {
+		t.Fatalf("unexpected event: %s", eventMsg.ToJson())
+	}
+
+	cancel()
+	for range ch {
+	}
+}
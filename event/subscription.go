@@ -0,0 +1,87 @@
+package event
+
+import (
+	"go.uber.org/zap"
+)
+
+const subscriptionBufferSize = 256
+
+// Record is a published EventMsg as delivered to local subscriptions, Data is its json
+type Record struct {
+	Seq         uint64
+	Topic       string
+	OperationId string
+	Data        []byte
+}
+
+// Subscription receives the events published on the bus in process, e.g. to bridge them to http clients
+type Subscription struct {
+	C      <-chan *Record
+	ch     chan *Record
+	topics map[string]bool
+	bus    *EventBus
+}
+
+// Subscribe returns a subscription to the given topics, every topic is subscribed when none is given.
+// A subscription that does not keep up loses events instead of blocking the publisher
+func (e *EventBus) Subscribe(topics ...string) *Subscription {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.subscribe(nil, topics)
+}
+
+// SubscribeFrom is Subscribe starting with the events of the history whose sequence is greater than since
+func (e *EventBus) SubscribeFrom(since uint64, topics ...string) *Subscription {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.subscribe(e.historySince(since), topics)
+}
+
+func (e *EventBus) subscribe(replay []*Record, topics []string) *Subscription {
+	ch := make(chan *Record, subscriptionBufferSize+len(replay))
+	subscription := &Subscription{
+		C:      ch,
+		ch:     ch,
+		topics: make(map[string]bool),
+		bus:    e,
+	}
+	for _, topic := range topics {
+		subscription.topics[topic] = true
+	}
+	for _, record := range replay {
+		if subscription.match(record) {
+			ch <- record
+		}
+	}
+	e.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+// Close stops the delivery and closes C
+func (s *Subscription) Close() {
+	s.bus.lock.Lock()
+	defer s.bus.lock.Unlock()
+	if _, ok := s.bus.subscriptions[s]; !ok {
+		return
+	}
+	delete(s.bus.subscriptions, s)
+	close(s.ch)
+}
+
+func (s *Subscription) match(record *Record) bool {
+	return len(s.topics) == 0 || s.topics[record.Topic]
+}
+
+// dispatch is called with the lock held
+func (e *EventBus) dispatch(record *Record) {
+	for subscription := range e.subscriptions {
+		if !subscription.match(record) {
+			continue
+		}
+		select {
+		case subscription.ch <- record:
+		default:
+			zap.L().Sugar().Warnf("subscription is full, drop event %s", string(record.Data))
+		}
+	}
+}
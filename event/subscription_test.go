@@ -0,0 +1,50 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"go.nanomsg.org/mangos/v3/protocol/pub"
+	"testing"
+)
+
+func TestSubscription(t *testing.T) {
+	sock, err := pub.NewSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sock.Close()
+	bus := newEventBus(sock)
+	podSubscription := bus.Subscribe(Pod)
+	allSubscription := bus.Subscribe()
+	defer allSubscription.Close()
+
+	if err := bus.Publish(context.Background(), &PodEventData{Name: "nginx", Type: PodEventReadyType}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(context.Background(), &IngressEventData{Type: IngressEventChange}); err != nil {
+		t.Fatal(err)
+	}
+
+	record := <-podSubscription.C
+	var eventMsg EventMsg
+	if err := json.Unmarshal(record.Data, &eventMsg); err != nil {
+		t.Fatal(err)
+	}
+	if record.Topic != Pod || eventMsg.PodEventData == nil || eventMsg.PodEventData.Name != "nginx" {
+		t.Fatalf("unexpected record: %s", string(record.Data))
+	}
+	select {
+	case record := <-podSubscription.C:
+		t.Fatalf("topic filter is not applied: %s", string(record.Data))
+	default:
+	}
+	if len(allSubscription.C) != 2 {
+		t.Fatalf("expect 2 records, got %d", len(allSubscription.C))
+	}
+
+	podSubscription.Close()
+	if _, ok := <-podSubscription.C; ok {
+		t.Fatal("channel is not closed")
+	}
+	podSubscription.Close()
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "tpc"
+
+var (
+	PodReady = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pod_ready",
+		Help:      "Whether the pod is ready (1) or not (0).",
+	}, []string{"pod"})
+	PodStartupDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pod_startup_duration_seconds",
+		Help:      "Duration of the last startup of the pod, from pause container creation to ready.",
+	}, []string{"pod"})
+	ContainerRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "container_restarts_total",
+		Help:      "Number of times a pod container has been started again, recreations of the pod are not counted.",
+	}, []string{"pod", "container"})
+	ImagePullDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_pull_duration_seconds",
+		Help:      "Duration of image pulls.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"image", "result"})
+	TaskGroupRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "task_group_runs_total",
+		Help:      "Number of task group runs.",
+	}, []string{"task_group", "result"})
+	TaskGroupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_group_duration_seconds",
+		Help:      "Duration of task group runs.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800},
+	}, []string{"task_group"})
+	ApiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of the agent api requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "path", "status"})
+	EventBusPublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_bus_publish_errors_total",
+		Help:      "Number of events that could not be sent to the event bus.",
+	}, []string{"topic"})
+)
+
+const ResultSuccess = "success"
+const ResultFail = "fail"
+
+func Result(err error) string {
+	if err != nil {
+		return ResultFail
+	}
+	return ResultSuccess
+}
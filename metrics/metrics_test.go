@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	ContainerRestarts.WithLabelValues("db", "mysql").Inc()
+	if v := testutil.ToFloat64(ContainerRestarts.WithLabelValues("db", "mysql")); v != 1 {
+		t.Fatalf("unexpected restarts: %v", v)
+	}
+	if _, err := ContainerRestarts.GetMetricWithLabelValues("db"); err == nil {
+		t.Fatal("restarts are labeled by pod and container")
+	}
+	PodReady.WithLabelValues("db").Set(1)
+	TaskGroupRuns.WithLabelValues("init", Result(errors.New("exit 1"))).Inc()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	for _, name := range []string{"tpc_container_restarts_total", "tpc_pod_ready", "tpc_task_group_runs_total"} {
+		if !names[name] {
+			t.Fatalf("%s is not registered", name)
+		}
+	}
+	problems, err := testutil.GatherAndLint(prometheus.DefaultGatherer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range problems {
+		if strings.HasPrefix(problem.Metric, namespace+"_") {
+			t.Fatalf("lint %s: %s", problem.Metric, problem.Text)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"context"
+	ginzap "github.com/gin-contrib/zap"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"net/http"
+	"podcompose/common"
+	"podcompose/compose"
+	"podcompose/event"
+	"podcompose/metrics"
+	"podcompose/trace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errVolumeGroupNotFound = errors.New("not found group")
+var errPortFormat = errors.New("port format error")
+
+type Api struct {
+	agent      *compose.Agent
+	compose    *compose.Compose
+	startFuc   func(ctx context.Context) error
+	stopFuc    func(ctx context.Context) error
+	quit       chan bool
+	operations *operations
+	session    *compose.SessionLock
+}
+
+func NewApi(c *compose.Compose, quit chan bool, startFuc func(ctx context.Context) error, stopFuc func(ctx context.Context) error) *Api {
+	api := &Api{
+		compose:    c,
+		quit:       quit,
+		startFuc:   startFuc,
+		stopFuc:    stopFuc,
+		agent:      compose.NewAgent(c),
+		operations: newOperations(),
+		session:    c.Session(),
+	}
+	if event.Bus != nil {
+		go api.operations.watch(event.Bus.Subscribe())
+	}
+	return api
+}
+
+func (a *Api) GetRoute() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(ginzap.Ginzap(zap.L(), time.RFC3339, true))
+	router.Use(ginzap.RecoveryWithZap(zap.L(), true))
+	router.Use(metricsMiddleware())
+	router.Use(operationMiddleware())
+	router.GET(common.EndPointAgentHealth, a.health)
+	// compatibility alias of the misspelled health endpoint
+	router.GET(common.EndPointAgentHealthAlias, a.health)
+	router.POST(common.EndPointAgentStart, a.start)
+	router.POST(common.EndPointAgentStop, a.stop)
+	router.POST(common.EndPointAgentShutdown, a.shutdown)
+	router.POST(common.EndPointAgentTaskGroup, func(c *gin.Context) {
+		var taskGroupBody common.TaskGroupRequest
+		err := c.BindJSON(&taskGroupBody)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		a.runTaskGroup(c, taskGroupBody.Name)
+	})
+	router.POST(common.EndPointAgentSwitchData, func(c *gin.Context) {
+		var switchDataBody common.SwitchDataRequest
+		err := c.BindJSON(&switchDataBody)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if group, _ := a.compose.GetConfig().VolumeGroups.GetGroup(switchDataBody.Name); group == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": errVolumeGroupNotFound.Error(),
+			})
+			return
+		}
+		a.runOperation(c, "switch", "switch data ok", http.StatusInternalServerError, func(ctx context.Context) error {
+			return a.switchData(ctx, switchDataBody.Name)
+		})
+	})
+	router.POST(common.EndPointAgentRestart, func(c *gin.Context) {
+		var restartBody common.RestartRequest
+		err := c.BindJSON(&restartBody)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		for _, name := range restartBody {
+			if !a.hasPod(name) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"message": "pod name:" + name + " is not exist",
+				})
+				return
+			}
+		}
+		a.runOperation(c, "restart", "restart ok", http.StatusBadRequest, func(ctx context.Context) error {
+			return a.compose.RestartPods(ctx, restartBody, func() error {
+				return nil
+			})
+		})
+	})
+	router.POST(common.EndPointAgentIngress, func(c *gin.Context) {
+		var ingressBody common.IngressRequest
+		err := c.BindJSON(&ingressBody)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if err = validateIngress(ingressBody); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		a.runOperation(c, "ingress", "set ingress ok", http.StatusInternalServerError, func(ctx context.Context) error {
+			_, err := a.agent.StartAgentForIngress(ctx, ingressBody)
+			return err
+		})
+	})
+	router.POST(common.EndPointAgentVolumes+"/:name/snapshot", a.snapshotVolume)
+	router.POST(common.EndPointAgentVolumes+"/:name/restore", a.restoreVolume)
+	router.GET(common.EndPointAgentVolumes+"/:name/export", a.exportVolume)
+	router.GET(common.EndPointAgentInfo, a.info)
+	router.GET(common.EndPointAgentStats, a.stats)
+	router.GET(common.EndPointAgentMetrics, gin.WrapH(promhttp.Handler()))
+	router.GET(common.EndPointAgentTrace, a.trace)
+	router.GET(common.EndPointAgentEvents, a.events)
+	router.GET(common.EndPointAgentEventHistory, a.eventHistory)
+	router.GET(common.EndPointAgentOperations, a.listOperations)
+	router.GET(common.EndPointAgentOperations+"/:id", a.getOperation)
+	router.DELETE(common.EndPointAgentOperations+"/:id", a.cancelOperation)
+	a.registerV1(router)
+	return router
+}
+
+func (a *Api) health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ok",
+	})
+}
+
+func (a *Api) start(c *gin.Context) {
+	a.runOperation(c, "start", "ok", http.StatusInternalServerError, a.startFuc)
+}
+
+func (a *Api) stop(c *gin.Context) {
+	release, ok := a.lockSession(c, "stop")
+	if !ok {
+		return
+	}
+	defer release()
+	err := a.stopFuc(operationContext(c))
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "stop success",
+		})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": err.Error(),
+		})
+	}
+}
+
+func (a *Api) shutdown(c *gin.Context) {
+	ctx := operationContext(c)
+	if err := a.compose.StopStats(); err != nil {
+		zap.L().Sugar().Errorf("write stats summary error: %s", err)
+	}
+	go func() {
+		_ = a.agent.StartAgentForClean(ctx)
+	}()
+	a.quit <- true
+	c.JSON(http.StatusOK, gin.H{
+		"message": "shutdown",
+	})
+}
+
+func (a *Api) runTaskGroup(c *gin.Context, name string) {
+	release, ok := a.lockSession(c, "task group "+name)
+	if !ok {
+		return
+	}
+	defer release()
+	err := a.compose.StartUserTaskGroup(operationContext(c), name)
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "run task success",
+		})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": err.Error(),
+		})
+	}
+}
+
+func (a *Api) info(c *gin.Context) {
+	c.JSON(http.StatusOK, a.agent.GetInfo())
+}
+
+func (a *Api) stats(c *gin.Context) {
+	c.JSON(http.StatusOK, a.compose.GetStats())
+}
+
+func (a *Api) trace(c *gin.Context) {
+	var body []byte
+	var err error
+	if c.Query("format") == "otlp" {
+		body, err = trace.DefaultRecorder.OTLP()
+	} else {
+		body, err = trace.DefaultRecorder.ChromeTrace()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// switchData recreates the volumes of the group and restarts the pods who used them
+func (a *Api) switchData(ctx context.Context, name string) error {
+	if group, _ := a.compose.GetConfig().VolumeGroups.GetGroup(name); group == nil {
+		return errVolumeGroupNotFound
+	}
+	return a.compose.SwitchVolumeGroup(ctx, a.agent, name)
+}
+
+// snapshotVolume copies the volume into the snapshot of the snapshot query
+func (a *Api) snapshotVolume(c *gin.Context) {
+	name, snapshot, ok := a.volumeSnapshotParams(c)
+	if !ok {
+		return
+	}
+	a.runOperation(c, "snapshot", "snapshot ok", http.StatusInternalServerError, func(ctx context.Context) error {
+		return a.compose.SnapshotVolume(ctx, name, snapshot)
+	})
+}
+
+// restoreVolume restarts the pods using the volume with the data of the snapshot of the snapshot query
+func (a *Api) restoreVolume(c *gin.Context) {
+	name, snapshot, ok := a.volumeSnapshotParams(c)
+	if !ok {
+		return
+	}
+	found, err := a.compose.FindSnapshot(c.Request.Context(), name, snapshot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	if found == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "not found snapshot " + snapshot + " of volume " + name,
+		})
+		return
+	}
+	a.runOperation(c, "restore", "restore ok", http.StatusInternalServerError, func(ctx context.Context) error {
+		return a.compose.RestoreVolume(ctx, name, snapshot)
+	})
+}
+
+// exportVolume streams the files of the volume the containers mount as a tar archive, e.g. the cache volume
+// of a read only cached volume
+func (a *Api) exportVolume(c *gin.Context) {
+	name := c.Param("name")
+	if !a.compose.HasVolume(name) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "not found volume " + name,
+		})
+		return
+	}
+	source, ok := a.compose.GetVolumeSources()[name]
+	if !ok {
+		source = name
+	}
+	archive, err := a.compose.GetRuntime().ExportVolume(c.Request.Context(), source, a.compose.GetSessionId())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	defer archive.Close()
+	c.DataFromReader(http.StatusOK, -1, "application/x-tar", archive, map[string]string{
+		"Content-Disposition": `attachment; filename="` + name + `.tar"`,
+	})
+}
+
+func (a *Api) volumeSnapshotParams(c *gin.Context) (string, string, bool) {
+	name := c.Param("name")
+	snapshot := c.Query("snapshot")
+	if !a.compose.HasVolume(name) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "not found volume " + name,
+		})
+		return "", "", false
+	}
+	if snapshot == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "snapshot must be set",
+		})
+		return "", "", false
+	}
+	return name, snapshot, true
+}
+
+func validateIngress(ingress common.IngressRequest) error {
+	for _, ports := range ingress {
+		pair := strings.Split(ports, ":")
+		if len(pair) != 2 {
+			return errPortFormat
+		}
+		if _, err := strconv.ParseInt(pair[0], 10, 64); err != nil {
+			return errPortFormat
+		}
+		if _, err := strconv.ParseInt(pair[1], 10, 64); err != nil {
+			return errPortFormat
+		}
+	}
+	return nil
+}
+
+// operationMiddleware gives every call an operation id, the caller may choose it with the X-Operation-Id header,
+// the id is returned in the same header and set on the events published by the call
+func operationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		operationId := c.GetHeader(event.OperationIdHeader)
+		if operationId == "" {
+			operationId = event.NewOperationId()
+		}
+		c.Set(event.OperationIdHeader, operationId)
+		c.Header(event.OperationIdHeader, operationId)
+		c.Next()
+	}
+}
+
+// operationContext carries the operation id of the call, it is not canceled with the request
+// so that an operation is not left half done when the caller goes away
+func operationContext(c *gin.Context) context.Context {
+	return event.WithOperationId(context.Background(), c.GetString(event.OperationIdHeader))
+}
+
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		path := c.FullPath()
+		if path == "" {
+			path = "unknown"
+		}
+		metrics.ApiRequestDuration.WithLabelValues(c.Request.Method, path, strconv.Itoa(c.Writer.Status())).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"podcompose/compose"
+	"podcompose/docker"
+	"podcompose/docker/fake"
+	"testing"
+)
+
+const cachedExportConfig = `
+version: 1
+volumes:
+  - name: fixtures
+    path: fixtures
+    cache: true
+    readOnly: true
+pods:
+  - name: db
+    containers:
+      - name: db
+        image: mysql
+        volumeMounts:
+          - name: fixtures
+            mountPath: /fixtures
+`
+
+func TestExportCachedVolume(t *testing.T) {
+	contextPath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(contextPath, "fixtures"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(contextPath, "fixtures", "users.csv"), []byte("id,name\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	c, err := compose.NewComposeWithRuntime([]byte(cachedExportConfig), "s1", contextPath, "", fake.NewRuntime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.PrepareNetwork(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Start(ctx, compose.NewAgent(c)); err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopPods(ctx)
+
+	w := httptest.NewRecorder()
+	(&Api{compose: c}).GetRoute().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/volumes/fixtures:export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	exported := t.TempDir()
+	if err = docker.ExtractArchive(w.Body, exported); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(exported, "users.csv")); string(content) != "id,name\n" {
+		t.Fatalf("the cache volume the containers mount is not exported: %q", content)
+	}
+
+	bundle := t.TempDir()
+	if err = docker.ExportVolumes(ctx, c.GetRuntime(), "s1", bundle, c.GetVolumeSources()); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(bundle, "fixtures", "users.csv")); string(content) != "id,name\n" {
+		t.Fatalf("the cache volume is not in the bundle: %q", content)
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net/http"
+	"podcompose/event"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const eventsKeepAliveInterval = 15 * time.Second
+
+var upgrader = websocket.Upgrader{
+	// the event stream is read only, test harnesses may connect from any origin
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// events streams the EventMsg json of the event bus as server-sent events, or as websocket text messages
+// when the request is a websocket upgrade, topic query parameters filter the events.
+// The stream resumes after the sequence of the since query parameter or of the Last-Event-ID header,
+// format=cloudevents sends CloudEvents instead of EventMsg and operation keeps the events of one operation
+func (a *Api) events(c *gin.Context) {
+	if event.Bus == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"message": "event bus is not started",
+		})
+		return
+	}
+	view, _, err := a.eventView(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	var subscription *event.Subscription
+	since, ok, err := querySince(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	if ok {
+		subscription = event.Bus.SubscribeFrom(since, queryTopics(c)...)
+	} else {
+		subscription = event.Bus.Subscribe(queryTopics(c)...)
+	}
+	defer subscription.Close()
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		streamWebsocket(c, subscription, view)
+		return
+	}
+	streamSSE(c, subscription, view)
+}
+
+func (a *Api) eventHistory(c *gin.Context) {
+	if event.Bus == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"message": "event bus is not started",
+		})
+		return
+	}
+	view, contentType, err := a.eventView(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	since, _, err := querySince(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	history := make([]json.RawMessage, 0)
+	for _, record := range event.Bus.History(since, queryTopics(c)...) {
+		if data, ok := view.render(record); ok {
+			history = append(history, data)
+		}
+	}
+	if contentType == event.CloudEventsContentType {
+		contentType = event.CloudEventsBatchContentType
+	}
+	body, err := json.Marshal(history)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// eventView selects and encodes the records sent to a client
+type eventView struct {
+	operationId string
+	encode      func(data []byte) ([]byte, error)
+}
+
+// render returns the encoded record, false when the record is filtered out or can not be encoded
+func (v *eventView) render(record *event.Record) ([]byte, bool) {
+	if v.operationId != "" && record.OperationId != v.operationId {
+		return nil, false
+	}
+	data, err := v.encode(record.Data)
+	if err != nil {
+		zap.L().Sugar().Errorf("encode event %d error: %s", record.Seq, err)
+		return nil, false
+	}
+	return data, true
+}
+
+// eventView returns the view of the query and its content type,
+// the format query parameter overrides the eventFormat of the config
+func (a *Api) eventView(c *gin.Context) (*eventView, string, error) {
+	view := &eventView{operationId: c.Query("operation")}
+	format := c.Query("format")
+	if format == "" && a.compose != nil {
+		format = a.compose.GetConfig().EventFormat
+	}
+	switch format {
+	case "", "json":
+		view.encode = func(data []byte) ([]byte, error) {
+			return data, nil
+		}
+		return view, "application/json", nil
+	case event.FormatCloudEvents:
+		source := event.Bus.CloudEventsSource()
+		if source == "" && a.compose != nil {
+			source = a.compose.GetSessionId()
+		}
+		if source == "" {
+			return nil, "", errors.New("cloudevents source is unknown until the config is loaded")
+		}
+		view.encode = func(data []byte) ([]byte, error) {
+			return event.EncodeCloudEvent(data, source)
+		}
+		return view, event.CloudEventsContentType, nil
+	}
+	return nil, "", errors.Errorf("unknown event format %s", format)
+}
+
+func querySince(c *gin.Context) (uint64, bool, error) {
+	since := c.Query("since")
+	if since == "" {
+		since = c.GetHeader("Last-Event-ID")
+	}
+	if since == "" {
+		return 0, false, nil
+	}
+	seq, err := strconv.ParseUint(since, 10, 64)
+	if err != nil {
+		return 0, false, errors.Errorf("since %s is not a sequence", since)
+	}
+	return seq, true, nil
+}
+
+// queryTopics accepts both ?topic=pod&topic=container and ?topic=pod,container
+func queryTopics(c *gin.Context) []string {
+	topics := make([]string, 0)
+	for _, value := range c.QueryArray("topic") {
+		for _, topic := range strings.Split(value, ",") {
+			if topic = strings.TrimSpace(topic); topic != "" {
+				topics = append(topics, topic)
+			}
+		}
+	}
+	return topics
+}
+
+func streamSSE(c *gin.Context, subscription *event.Subscription, view *eventView) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	ticker := time.NewTicker(eventsKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case record, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+			data, ok := view.render(record)
+			if !ok {
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", record.Seq, record.Topic, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+func streamWebsocket(c *gin.Context, subscription *event.Subscription, view *eventView) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		zap.L().Sugar().Errorf("websocket upgrade error: %s", err)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	// the client does not send anything, reading detects the close
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(eventsKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case record, ok := <-subscription.C:
+			if !ok {
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			data, ok := view.render(record)
+			if !ok {
+				continue
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsKeepAliveInterval)); err != nil {
+				return
+			}
+		}
+	}
+}
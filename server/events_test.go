@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"podcompose/event"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	if _, err := event.ListenEventBus("tcp://127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = event.Bus.Close()
+		event.Bus = nil
+	}()
+	server := httptest.NewServer((&Api{}).GetRoute())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?topic=pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/events?topic=ingress,pod", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the handlers subscribe before the sse headers are flushed and before the websocket upgrade,
+	// so both subscriptions are registered once the requests above return
+	ctx := event.WithOperationId(context.Background(), "switch")
+	event.Publish(ctx, &event.IngressEventData{Type: event.IngressEventChange})
+	event.Publish(context.Background(), &event.PodEventData{Name: "nginx", Type: event.PodEventReadyType})
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "id: ") {
+		t.Fatalf("unexpected sse line: %q %v", line, err)
+	}
+	line, err = reader.ReadString('\n')
+	if err != nil || line != "event: pod\n" {
+		t.Fatalf("unexpected sse line: %q %v", line, err)
+	}
+	line, err = reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "data: ") || !strings.Contains(line, "nginx") {
+		t.Fatalf("unexpected sse line: %q %v", line, err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expect := range []string{event.Ingress, event.Pod} {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(message), `"Topic":"`+expect+`"`) {
+			t.Fatalf("unexpected websocket message: %s", string(message))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	(&Api{}).GetRoute().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/events/history?topic=ingress", nil))
+	var history []event.EventMsg
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) == 0 || history[len(history)-1].IngressEventData == nil || history[len(history)-1].Seq == 0 {
+		t.Fatalf("unexpected history: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/v1/events/history?operation=switch", nil)
+	request.Header.Set(event.OperationIdHeader, "history")
+	(&Api{}).GetRoute().ServeHTTP(w, request)
+	if w.Header().Get(event.OperationIdHeader) != "history" {
+		t.Fatalf("operation id is not returned: %v", w.Header())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].OperationId != "switch" {
+		t.Fatalf("unexpected history: %s", w.Body.String())
+	}
+
+	// the cloudevents source is the one of the bus when there is no compose yet
+	w = httptest.NewRecorder()
+	(&Api{}).GetRoute().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/events/history?format=cloudevents", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d without a cloudevents source: %s", w.Code, w.Body.String())
+	}
+	event.Bus.UseCloudEvents("s1")
+	w = httptest.NewRecorder()
+	(&Api{}).GetRoute().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/events/history?format=cloudevents&topic=ingress", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"source":"s1"`) {
+		t.Fatalf("unexpected cloudevents history %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"podcompose/common"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const openAPIVersion = "3.0.3"
+const apiVersion = "1.0.0"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// openAPIDocument generates the OpenAPI 3 document of the routes, request and response schemas
+// are derived from the go types and registered as components
+func openAPIDocument(routes []*route) ([]byte, error) {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+	for _, r := range routes {
+		item, ok := paths[r.path]
+		if !ok {
+			item = make(map[string]interface{})
+			paths[r.path] = item
+		}
+		item[strings.ToLower(r.method)] = openAPIOperation(r, schemas)
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   "testcompose agent api",
+			"version": apiVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}, "", "  ")
+}
+
+func openAPIOperation(op *route, schemas map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{
+		"operationId": op.operationId,
+		"summary":     op.summary,
+	}
+	parameters := make([]interface{}, 0)
+	for _, segment := range strings.Split(op.path, "/") {
+		if index := strings.LastIndex(segment, ":"); index > 0 {
+			segment = segment[:index]
+		}
+		if isPathParam(segment) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     segment[1 : len(segment)-1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	query := op.query
+	if op.async {
+		query = append(query, "wait", "queue")
+	}
+	for _, name := range query {
+		parameters = append(parameters, map[string]interface{}{
+			"name":   name,
+			"in":     "query",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(parameters) > 0 {
+		result["parameters"] = parameters
+	}
+	if op.request != nil {
+		result["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(schemaOf(reflect.TypeOf(op.request), schemas)),
+		}
+	}
+	responses := map[string]interface{}{
+		"default": map[string]interface{}{
+			"description": "error",
+			"content":     jsonContent(map[string]interface{}{"$ref": "#/components/schemas/Message"}),
+		},
+	}
+	if op.response != nil {
+		contentType := op.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		responses["200"] = map[string]interface{}{
+			"description": http.StatusText(http.StatusOK),
+			"content":     content(contentType, schemaOf(reflect.TypeOf(op.response), schemas)),
+		}
+	}
+	if op.async {
+		responses["202"] = map[string]interface{}{
+			"description": http.StatusText(http.StatusAccepted),
+			"content":     jsonContent(schemaOf(reflect.TypeOf(common.OperationInfo{}), schemas)),
+		}
+	}
+	result["responses"] = responses
+	return result
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return content("application/json", schema)
+}
+
+func content(contentType string, schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		contentType: map[string]interface{}{
+			"schema": schema,
+		},
+	}
+}
+
+// schemaOf returns the schema of t, named structs are added to schemas and referenced
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			// register before resolving the fields so recursive types terminate
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	addStructProperties(t, properties, schemas)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// addStructProperties follows encoding/json: embedded structs are flattened and the json tag names the property
+func addStructProperties(t reflect.Type, properties map[string]interface{}, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructProperties(field.Type, properties, schemas)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaOf(field.Type, schemas)
+	}
+}
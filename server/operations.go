@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+	"podcompose/common"
+	"podcompose/compose"
+	"podcompose/event"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxOperations bounds the kept operations, the oldest finished ones are forgotten first
+const maxOperations = 256
+
+var errOperationExists = errors.New("operation id is already used")
+
+type operation struct {
+	info   common.OperationInfo
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// operations runs the long-running api calls in background and keeps their state
+type operations struct {
+	lock       sync.Mutex
+	operations map[string]*operation
+	order      []string
+}
+
+func newOperations() *operations {
+	return &operations{
+		operations: make(map[string]*operation),
+		order:      make([]string, 0),
+	}
+}
+
+// watch counts the events of every running operation until the subscription is closed
+func (o *operations) watch(subscription *event.Subscription) {
+	for record := range subscription.C {
+		if record.OperationId == "" {
+			continue
+		}
+		var eventMsg event.EventMsg
+		if err := json.Unmarshal(record.Data, &eventMsg); err != nil {
+			continue
+		}
+		o.lock.Lock()
+		if op, ok := o.operations[record.OperationId]; ok {
+			op.info.Events++
+			op.info.Progress = eventMsg.Type()
+		}
+		o.lock.Unlock()
+	}
+}
+
+// start runs fn in background, ctx carries the operation id and is canceled by cancel
+func (o *operations) start(ctx context.Context, name string, status string, fn func(ctx context.Context) error) (*operation, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	op := &operation{
+		info: common.OperationInfo{
+			Id:         event.OperationId(ctx),
+			Name:       name,
+			Status:     status,
+			CreateTime: time.Now(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	o.lock.Lock()
+	if _, ok := o.operations[op.info.Id]; ok {
+		o.lock.Unlock()
+		cancel()
+		return nil, errOperationExists
+	}
+	o.operations[op.info.Id] = op
+	o.order = append(o.order, op.info.Id)
+	o.evict()
+	o.lock.Unlock()
+	go func() {
+		err := fn(ctx)
+		o.lock.Lock()
+		defer o.lock.Unlock()
+		endTime := time.Now()
+		op.err = err
+		op.info.EndTime = &endTime
+		switch {
+		case err == nil:
+			op.info.Status = common.OperationStatusSucceeded
+		case ctx.Err() != nil:
+			op.info.Status = common.OperationStatusCanceled
+			op.info.Error = err.Error()
+		default:
+			op.info.Status = common.OperationStatusFailed
+			op.info.Error = err.Error()
+		}
+		cancel()
+		close(op.done)
+	}()
+	return op, nil
+}
+
+// evict is called with the lock held
+func (o *operations) evict() {
+	for i := 0; len(o.operations) > maxOperations && i < len(o.order); {
+		op := o.operations[o.order[i]]
+		if op.info.EndTime == nil {
+			i++
+			continue
+		}
+		delete(o.operations, o.order[i])
+		o.order = append(o.order[:i], o.order[i+1:]...)
+	}
+}
+
+// running marks a queued operation as running
+func (o *operations) running(id string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if op, ok := o.operations[id]; ok && op.info.EndTime == nil {
+		op.info.Status = common.OperationStatusRunning
+	}
+}
+
+func (o *operations) get(id string) (common.OperationInfo, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	op, ok := o.operations[id]
+	if !ok {
+		return common.OperationInfo{}, false
+	}
+	return op.info, true
+}
+
+func (o *operations) list() []common.OperationInfo {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	result := make([]common.OperationInfo, 0, len(o.order))
+	for _, id := range o.order {
+		result = append(result, o.operations[id].info)
+	}
+	return result
+}
+
+func (o *operations) cancel(id string) (common.OperationInfo, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	op, ok := o.operations[id]
+	if !ok {
+		return common.OperationInfo{}, false
+	}
+	op.cancel()
+	return op.info, true
+}
+
+// runOperation answers 202 with the operation and runs fn in background holding the session lock,
+// with the wait query parameter it blocks and answers like the synchronous api did.
+// A call conflicting with a running operation gets 409, unless the queue query parameter queues it
+func (a *Api) runOperation(c *gin.Context, name string, successMessage string, errorStatus int, fn func(ctx context.Context) error) {
+	ctx := operationContext(c)
+	holder := compose.SessionHolder{OperationId: event.OperationId(ctx), Name: name}
+	status := common.OperationStatusQueued
+	var release func()
+	if queue, _ := strconv.ParseBool(c.Query("queue")); !queue {
+		var err error
+		release, err = a.session.TryAcquire(holder)
+		if err != nil {
+			conflict(c, err)
+			return
+		}
+		status = common.OperationStatusRunning
+	}
+	op, err := a.operations.start(ctx, name, status, func(ctx context.Context) error {
+		if release == nil {
+			var err error
+			if release, err = a.session.Acquire(ctx, holder); err != nil {
+				return err
+			}
+			a.operations.running(holder.OperationId)
+		}
+		defer release()
+		return fn(ctx)
+	})
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	if wait, _ := strconv.ParseBool(c.Query("wait")); !wait {
+		c.Header("Location", v1Prefix+"/operations/"+op.info.Id)
+		info, _ := a.operations.get(op.info.Id)
+		c.JSON(http.StatusAccepted, info)
+		return
+	}
+	select {
+	case <-op.done:
+	case <-c.Request.Context().Done():
+		// the caller went away, the operation goes on and can be followed with its id
+		return
+	}
+	if op.err != nil {
+		c.JSON(errorStatus, gin.H{
+			"message": op.err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": successMessage,
+	})
+}
+
+// lockSession takes the session lock for a synchronous call, it answers 409 and returns false on conflict,
+// with the queue query parameter it waits for the lock as long as the caller does
+func (a *Api) lockSession(c *gin.Context, name string) (func(), bool) {
+	holder := compose.SessionHolder{OperationId: c.GetString(event.OperationIdHeader), Name: name}
+	var release func()
+	var err error
+	if queue, _ := strconv.ParseBool(c.Query("queue")); queue {
+		release, err = a.session.Acquire(c.Request.Context(), holder)
+	} else {
+		release, err = a.session.TryAcquire(holder)
+	}
+	if err != nil {
+		conflict(c, err)
+		return nil, false
+	}
+	return release, true
+}
+
+func conflict(c *gin.Context, err error) {
+	response := gin.H{
+		"message": err.Error(),
+	}
+	var conflictError *compose.ConflictError
+	if errors.As(err, &conflictError) {
+		response["operationId"] = conflictError.Holder.OperationId
+	}
+	c.JSON(http.StatusConflict, response)
+}
+
+func (a *Api) listOperations(c *gin.Context) {
+	c.JSON(http.StatusOK, a.operations.list())
+}
+
+func (a *Api) getOperation(c *gin.Context) {
+	info, ok := a.operations.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "not found operation " + c.Param("id"),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// cancelOperation cancels the context of the operation, the state turns to canceled once the work stops
+func (a *Api) cancelOperation(c *gin.Context) {
+	info, ok := a.operations.cancel(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "not found operation " + c.Param("id"),
+		})
+		return
+	}
+	if info.EndTime != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"message": "operation " + info.Id + " is " + info.Status,
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, info)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"podcompose/common"
+	"podcompose/compose"
+	"podcompose/event"
+	"testing"
+	"time"
+)
+
+func TestOperations(t *testing.T) {
+	a := &Api{operations: newOperations(), session: compose.NewSessionLock()}
+	router := gin.New()
+	router.Use(operationMiddleware())
+	router.POST("/block", func(c *gin.Context) {
+		a.runOperation(c, "block", "ok", http.StatusInternalServerError, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	})
+	router.POST("/fail", func(c *gin.Context) {
+		a.runOperation(c, "fail", "ok", http.StatusBadRequest, func(ctx context.Context) error {
+			return errors.New("failed")
+		})
+	})
+	router.GET("/operations/:id", a.getOperation)
+	router.DELETE("/operations/:id", a.cancelOperation)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp := request(t, http.MethodPost, server.URL+"/block", nil)
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Location") == "" {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	var info common.OperationInfo
+	decode(t, resp, &info)
+	if info.Id != resp.Header.Get(event.OperationIdHeader) || info.Status != common.OperationStatusRunning {
+		t.Fatalf("unexpected operation: %+v", info)
+	}
+
+	resp = request(t, http.MethodPost, server.URL+"/block", map[string]string{event.OperationIdHeader: info.Id})
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expect conflict on a used operation id, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	resp = request(t, http.MethodDelete, server.URL+"/operations/"+info.Id, nil)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("unexpected cancel status: %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for info.Status == common.OperationStatusRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		resp = request(t, http.MethodGet, server.URL+"/operations/"+info.Id, nil)
+		decode(t, resp, &info)
+	}
+	if info.Status != common.OperationStatusCanceled || info.EndTime == nil {
+		t.Fatalf("expect canceled operation, got %+v", info)
+	}
+	resp = request(t, http.MethodDelete, server.URL+"/operations/"+info.Id, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expect conflict on a finished operation, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	resp = request(t, http.MethodPost, server.URL+"/fail?wait=true", nil)
+	var message common.Message
+	decode(t, resp, &message)
+	if resp.StatusCode != http.StatusBadRequest || message.Message != "failed" {
+		t.Fatalf("unexpected wait response: %d %+v", resp.StatusCode, message)
+	}
+	resp = request(t, http.MethodGet, server.URL+"/operations/"+resp.Header.Get(event.OperationIdHeader), nil)
+	decode(t, resp, &info)
+	if info.Status != common.OperationStatusFailed || info.Error != "failed" {
+		t.Fatalf("expect failed operation, got %+v", info)
+	}
+
+	resp = request(t, http.MethodGet, server.URL+"/operations/unknown", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status of unknown operation: %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+}
+
+func request(t *testing.T, method string, url string, header map[string]string) *http.Response {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func decode(t *testing.T, resp *http.Response, v interface{}) {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
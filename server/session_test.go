@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"podcompose/common"
+	"podcompose/compose"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider stands for the docker work of start and stop, it counts the calls running at the same time
+type fakeProvider struct {
+	running  int32
+	overlaps int32
+	calls    int32
+}
+
+func (f *fakeProvider) work(ctx context.Context) error {
+	atomic.AddInt32(&f.calls, 1)
+	if atomic.AddInt32(&f.running, 1) > 1 {
+		atomic.AddInt32(&f.overlaps, 1)
+	}
+	defer atomic.AddInt32(&f.running, -1)
+	select {
+	case <-time.After(20 * time.Millisecond):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newSessionTestServer(provider *fakeProvider) *httptest.Server {
+	a := &Api{
+		startFuc:   provider.work,
+		stopFuc:    provider.work,
+		operations: newOperations(),
+		session:    compose.NewSessionLock(),
+	}
+	return httptest.NewServer(a.GetRoute())
+}
+
+func TestSessionConflict(t *testing.T) {
+	provider := &fakeProvider{}
+	server := newSessionTestServer(provider)
+	defer server.Close()
+
+	paths := []string{common.EndPointAgentStart, common.EndPointAgentStop, "/v1/compose:start", "/v1/compose:stop"}
+	var accepted, conflicts int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp := request(t, http.MethodPost, server.URL+path+"?wait=true", nil)
+			var message map[string]string
+			decode(t, resp, &message)
+			switch resp.StatusCode {
+			case http.StatusOK:
+				atomic.AddInt32(&accepted, 1)
+			case http.StatusConflict:
+				if message["operationId"] == "" {
+					t.Errorf("conflict without the running operation: %v", message)
+				}
+				atomic.AddInt32(&conflicts, 1)
+			default:
+				t.Errorf("unexpected status %d: %v", resp.StatusCode, message)
+			}
+		}(paths[i%len(paths)])
+	}
+	wg.Wait()
+	if accepted == 0 || conflicts == 0 || accepted+conflicts != 16 {
+		t.Fatalf("unexpected result, accepted: %d, conflicts: %d", accepted, conflicts)
+	}
+	if provider.overlaps != 0 || provider.calls != accepted {
+		t.Fatalf("operations overlapped: %d, calls: %d", provider.overlaps, provider.calls)
+	}
+}
+
+func TestSessionQueue(t *testing.T) {
+	provider := &fakeProvider{}
+	server := newSessionTestServer(provider)
+	defer server.Close()
+
+	paths := []string{common.EndPointAgentStart + "?wait=true&queue=true", common.EndPointAgentStop + "?queue=true"}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp := request(t, http.MethodPost, server.URL+path, nil)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status of %s: %d", path, resp.StatusCode)
+			}
+		}(paths[i%len(paths)])
+	}
+	wg.Wait()
+	if provider.overlaps != 0 || provider.calls != 8 {
+		t.Fatalf("operations overlapped: %d, calls: %d", provider.overlaps, provider.calls)
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"podcompose/common"
+	"podcompose/event"
+	"strconv"
+	"strings"
+)
+
+const v1Prefix = "/v1"
+
+// customMethodParam is the gin parameter holding the last path segment of a custom method, e.g. "nginx:restart"
+const customMethodParam = "resource"
+
+// route is one route of the v1 api, path uses the OpenAPI template syntax,
+// a last segment like "{name}:restart" or "compose:start" is a custom method on the resource
+type route struct {
+	method      string
+	path        string
+	operationId string
+	summary     string
+	// query lists the optional query parameters
+	query []string
+	// contentType of the response, application/json when empty
+	contentType string
+	// async routes answer 202 with the operation, or response once done with wait=true,
+	// they take the session lock like the routes having the queue parameter
+	async    bool
+	request  interface{}
+	response interface{}
+	handler  gin.HandlerFunc
+}
+
+type customMethod struct {
+	// literal is the fixed resource of the method, empty when the resource is a path parameter
+	literal string
+	param   string
+	handler gin.HandlerFunc
+}
+
+func (a *Api) v1Routes() []*route {
+	return []*route{
+		{method: http.MethodGet, path: "/v1/health", operationId: "health", summary: "Check that the agent is running",
+			response: common.Message{}, handler: a.health},
+		{method: http.MethodGet, path: "/v1/info", operationId: "getInfo", summary: "Get the session, pods and ingresses",
+			response: common.Info{}, handler: a.info},
+		{method: http.MethodGet, path: "/v1/stats", operationId: "getStats", summary: "Get the resource usage of the running pods",
+			response: []common.PodStats{}, handler: a.stats},
+		{method: http.MethodGet, path: "/v1/trace", operationId: "getTrace", summary: "Get the startup trace, as Chrome trace or OTLP JSON with format=otlp",
+			query: []string{"format"}, response: map[string]interface{}{}, handler: a.trace},
+		{method: http.MethodGet, path: "/v1/events", operationId: "streamEvents", summary: "Stream the events as server-sent events, or websocket messages on upgrade, filtered by topic",
+			query: []string{"topic", "since", "format", "operation"}, contentType: "text/event-stream", response: event.EventMsg{}, handler: a.events},
+		{method: http.MethodGet, path: "/v1/events/history", operationId: "getEventHistory", summary: "Get the kept events whose sequence is greater than since",
+			query: []string{"topic", "since", "format", "operation"}, response: []event.EventMsg{}, handler: a.eventHistory},
+		{method: http.MethodPost, path: "/v1/compose:start", operationId: "startCompose", summary: "Start the compose when the agent is not in auto start mode",
+			async: true, response: common.Message{}, handler: a.start},
+		{method: http.MethodPost, path: "/v1/compose:stop", operationId: "stopCompose", summary: "Remove all pods and volumes, the agent keeps running",
+			query: []string{"queue"}, response: common.Message{}, handler: a.stop},
+		{method: http.MethodPost, path: "/v1/compose:shutdown", operationId: "shutdownCompose", summary: "Remove every resource of the session, including the agent",
+			response: common.Message{}, handler: a.shutdown},
+		{method: http.MethodPost, path: "/v1/pods/{name}:restart", operationId: "restartPod", summary: "Restart the pod and every pod depending on it",
+			async: true, response: common.Message{}, handler: a.restartPod},
+		{method: http.MethodPost, path: "/v1/volume-groups/{name}:activate", operationId: "activateVolumeGroup", summary: "Recreate the volumes of the group and restart the pods using them",
+			async: true, response: common.Message{}, handler: a.activateVolumeGroup},
+		{method: http.MethodPost, path: "/v1/volumes/{name}:snapshot", operationId: "snapshotVolume", summary: "Copy the volume into the snapshot, an existing snapshot of the name is replaced",
+			query: []string{"snapshot"}, async: true, response: common.Message{}, handler: a.snapshotVolume},
+		{method: http.MethodPost, path: "/v1/volumes/{name}:restore", operationId: "restoreVolume", summary: "Restart the pods using the volume with the data of the snapshot",
+			query: []string{"snapshot"}, async: true, response: common.Message{}, handler: a.restoreVolume},
+		{method: http.MethodGet, path: "/v1/volumes/{name}:export", operationId: "exportVolume", summary: "Download the files of the volume as a tar archive",
+			contentType: "application/x-tar", response: "", handler: a.exportVolume},
+		{method: http.MethodPost, path: "/v1/task-groups/{name}:run", operationId: "runTaskGroup", summary: "Run the task group and wait for it to finish",
+			query: []string{"queue"}, response: common.Message{}, handler: a.runTaskGroupV1},
+		{method: http.MethodGet, path: "/v1/ingresses", operationId: "listIngresses", summary: "List the pod ports exposed on the host",
+			response: []common.IngressInfo{}, handler: a.listIngresses},
+		{method: http.MethodPut, path: "/v1/ingresses/{name}", operationId: "putIngress", summary: "Expose a port of the pod on the host",
+			async: true, request: common.IngressSpec{}, response: common.Message{}, handler: a.putIngress},
+		{method: http.MethodDelete, path: "/v1/ingresses/{name}", operationId: "deleteIngress", summary: "Remove the ingress of the pod",
+			async: true, response: common.Message{}, handler: a.deleteIngress},
+		{method: http.MethodGet, path: "/v1/operations", operationId: "listOperations", summary: "List the kept asynchronous operations",
+			response: []common.OperationInfo{}, handler: a.listOperations},
+		{method: http.MethodGet, path: "/v1/operations/{id}", operationId: "getOperation", summary: "Get the status, progress and error of an operation",
+			response: common.OperationInfo{}, handler: a.getOperation},
+		{method: http.MethodDelete, path: "/v1/operations/{id}", operationId: "cancelOperation", summary: "Cancel a running operation",
+			response: common.OperationInfo{}, handler: a.cancelOperation},
+	}
+}
+
+func (a *Api) registerV1(router *gin.Engine) {
+	routes := a.v1Routes()
+	openapi, err := openAPIDocument(routes)
+	if err != nil {
+		panic(err)
+	}
+	router.GET(v1Prefix+"/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", openapi)
+	})
+	customMethods := make(map[string]map[string][]*customMethod)
+	for _, r := range routes {
+		ginPath, verb, method := toGinPath(r.path)
+		if verb == "" {
+			router.Handle(r.method, ginPath, r.handler)
+			continue
+		}
+		key := r.method + " " + ginPath
+		if _, ok := customMethods[key]; !ok {
+			customMethods[key] = make(map[string][]*customMethod)
+			router.Handle(r.method, ginPath, dispatchCustomMethod(customMethods[key]))
+		}
+		method.handler = r.handler
+		customMethods[key][verb] = append(customMethods[key][verb], method)
+	}
+}
+
+// toGinPath converts an OpenAPI path to a gin path, a custom method is returned with its verb,
+// gin can not route on the verb so all methods of a path share the customMethodParam parameter
+func toGinPath(path string) (string, string, *customMethod) {
+	segments := strings.Split(path, "/")
+	var verb string
+	var method *customMethod
+	for i, segment := range segments {
+		if i == len(segments)-1 {
+			if index := strings.LastIndex(segment, ":"); index > 0 {
+				verb = segment[index+1:]
+				resource := segment[:index]
+				method = &customMethod{}
+				if isPathParam(resource) {
+					method.param = resource[1 : len(resource)-1]
+				} else {
+					method.literal = resource
+				}
+				segments[i] = ":" + customMethodParam
+				continue
+			}
+		}
+		if isPathParam(segment) {
+			segments[i] = ":" + segment[1:len(segment)-1]
+		}
+	}
+	return strings.Join(segments, "/"), verb, method
+}
+
+func isPathParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func dispatchCustomMethod(methods map[string][]*customMethod) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resource := c.Param(customMethodParam)
+		if index := strings.LastIndex(resource, ":"); index > 0 {
+			name := resource[:index]
+			for _, method := range methods[resource[index+1:]] {
+				if method.literal == "" {
+					c.Params = append(c.Params, gin.Param{Key: method.param, Value: name})
+					method.handler(c)
+					return
+				}
+				if method.literal == name {
+					method.handler(c)
+					return
+				}
+			}
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "not found " + c.Request.URL.Path,
+		})
+	}
+}
+
+func (a *Api) restartPod(c *gin.Context) {
+	name := c.Param("name")
+	if !a.hasPod(name) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "pod name:" + name + " is not exist",
+		})
+		return
+	}
+	a.runOperation(c, "restart", "restart ok", http.StatusInternalServerError, func(ctx context.Context) error {
+		return a.compose.RestartPods(ctx, []string{name}, func() error {
+			return nil
+		})
+	})
+}
+
+func (a *Api) activateVolumeGroup(c *gin.Context) {
+	name := c.Param("name")
+	if group, _ := a.compose.GetConfig().VolumeGroups.GetGroup(name); group == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": errVolumeGroupNotFound.Error(),
+		})
+		return
+	}
+	a.runOperation(c, "switch", "switch data ok", http.StatusInternalServerError, func(ctx context.Context) error {
+		return a.switchData(ctx, name)
+	})
+}
+
+func (a *Api) runTaskGroupV1(c *gin.Context) {
+	name := c.Param("name")
+	if a.compose.GetConfig().TaskGroups.GetTaskGroupFromName(name) == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "not found task group " + name,
+		})
+		return
+	}
+	a.runTaskGroup(c, name)
+}
+
+func (a *Api) listIngresses(c *gin.Context) {
+	c.JSON(http.StatusOK, a.agent.GetInfo().Ingresses)
+}
+
+func (a *Api) putIngress(c *gin.Context) {
+	var ingressSpec common.IngressSpec
+	err := c.BindJSON(&ingressSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	if ingressSpec.ServicePort <= 0 || ingressSpec.HostPort <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": errPortFormat.Error(),
+		})
+		return
+	}
+	a.applyIngress(c, strconv.Itoa(ingressSpec.ServicePort)+":"+strconv.Itoa(ingressSpec.HostPort))
+}
+
+func (a *Api) deleteIngress(c *gin.Context) {
+	a.applyIngress(c, "0:0")
+}
+
+func (a *Api) applyIngress(c *gin.Context, ports string) {
+	name := c.Param("name")
+	if !a.hasPod(name) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "pod name:" + name + " is not exist",
+		})
+		return
+	}
+	a.runOperation(c, "ingress", "set ingress ok", http.StatusInternalServerError, func(ctx context.Context) error {
+		_, err := a.agent.StartAgentForIngress(ctx, common.IngressRequest{name: ports})
+		return err
+	})
+}
+
+func (a *Api) hasPod(name string) bool {
+	for _, pod := range a.compose.GetConfig().Pods {
+		if pod.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestToGinPath(t *testing.T) {
+	path, verb, method := toGinPath("/v1/pods/{name}:restart")
+	if path != "/v1/pods/:"+customMethodParam || verb != "restart" || method.param != "name" {
+		t.Fatalf("unexpected gin path: %s %s %+v", path, verb, method)
+	}
+	path, verb, method = toGinPath("/v1/compose:start")
+	if path != "/v1/:"+customMethodParam || verb != "start" || method.literal != "compose" {
+		t.Fatalf("unexpected gin path: %s %s %+v", path, verb, method)
+	}
+	path, verb, _ = toGinPath("/v1/ingresses/{name}")
+	if path != "/v1/ingresses/:name" || verb != "" {
+		t.Fatalf("unexpected gin path: %s %s", path, verb)
+	}
+}
+
+func TestV1Route(t *testing.T) {
+	router := (&Api{}).GetRoute()
+	for _, path := range []string{"/v1/health", "/health", "/heath"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/compose:unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	var document struct {
+		Paths      map[string]map[string]interface{}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := document.Paths["/v1/pods/{name}:restart"]["post"]; !ok {
+		t.Fatalf("restart operation is missing: %v", document.Paths)
+	}
+	if _, ok := document.Components.Schemas["PodStats"].Properties["CpuPercent"]; !ok {
+		t.Fatalf("embedded fields are not flattened: %v", document.Components.Schemas["PodStats"])
+	}
+	if _, ok := document.Components.Schemas["IngressSpec"].Properties["servicePort"]; !ok {
+		t.Fatalf("json tag is not used: %v", document.Components.Schemas["IngressSpec"])
+	}
+}
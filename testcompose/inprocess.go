@@ -0,0 +1,163 @@
+package testcompose
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"podcompose/common"
+	"podcompose/compose"
+	"podcompose/docker"
+	"podcompose/event"
+	"podcompose/server"
+	"podcompose/trace"
+	"sync"
+	"testing"
+	"time"
+)
+
+// inProcess is the agent api server and event bus running in the calling process
+type inProcess struct {
+	server       *http.Server
+	bus          *event.EventBus
+	ports        map[string]string
+	started      bool
+	shutdownOnce sync.Once
+}
+
+// NewInProcessTestCompose runs the compose, the agent api server and the event bus in the calling process
+// instead of the agent container, so testcompose can be debugged without building the agent image.
+// Volumes are seeded through helper containers and the session is cleaned by a Cleanup hook of tb.
+// The event bus is global, so one in process compose runs at a time
+func NewInProcessTestCompose(tb testing.TB, workspace string) (*TestCompose, error) {
+	t, err := NewTestCompose(workspace)
+	if err != nil {
+		return nil, err
+	}
+	return t.runInProcess(tb), nil
+}
+
+// NewInProcessTestComposeWithRuntime is NewInProcessTestCompose of the session on the given runtime, e.g. the fake one
+func NewInProcessTestComposeWithRuntime(tb testing.TB, workspace string, sessionId string, runtime docker.Runtime) (*TestCompose, error) {
+	configByte, err := os.ReadFile(filepath.Join(workspace, common.ConfigFileName))
+	if err != nil {
+		return nil, err
+	}
+	hostContextPath, _ := filepath.Abs(workspace)
+	c, err := compose.NewComposeWithRuntime(configByte, sessionId, workspace, hostContextPath, runtime)
+	if err != nil {
+		return nil, err
+	}
+	t := &TestCompose{compose: c, agent: compose.NewAgent(c), workspace: workspace}
+	return t.runInProcess(tb), nil
+}
+
+func (t *TestCompose) runInProcess(tb testing.TB) *TestCompose {
+	t.compose.SetInProcess(true)
+	t.inProcess = &inProcess{ports: make(map[string]string)}
+	tb.Cleanup(func() {
+		ctx := context.Background()
+		t.shutdownInProcess(ctx)
+		t.compose.GetRuntime().ClearWithSession(ctx, t.GetSessionId())
+	})
+	return t
+}
+
+func (t *TestCompose) startInProcess(ctx context.Context, autoStart bool) error {
+	busAddr, err := event.ListenEventBus("tcp://127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	t.inProcess.bus = event.Bus
+	if t.compose.GetConfig().EventFormat == event.FormatCloudEvents {
+		event.Bus.UseCloudEvents(t.GetSessionId())
+	}
+	t.compose.StartEventSinks(event.Bus)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.shutdownInProcess(ctx)
+		return err
+	}
+	if err = t.setInProcessPort(common.ServerAgentEventBusPort, busAddr); err != nil {
+		t.shutdownInProcess(ctx)
+		return err
+	}
+	if err = t.setInProcessPort(common.ServerAgentPort, "tcp://"+listener.Addr().String()); err != nil {
+		t.shutdownInProcess(ctx)
+		return err
+	}
+	quit := make(chan bool, 1)
+	api := server.NewApi(t.compose, quit, t.startCompose, t.stopCompose)
+	t.inProcess.server = &http.Server{Handler: api.GetRoute()}
+	go func() {
+		if err := t.inProcess.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			zap.L().Sugar().Errorf("in process agent server error: %s", err)
+		}
+	}()
+	go func() {
+		<-quit
+		t.shutdownInProcess(context.Background())
+	}()
+	if autoStart {
+		go func() {
+			if err := t.compose.AutoStart(t.startCompose); err != nil {
+				zap.L().Sugar().Errorf("start compose error: %s", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (t *TestCompose) setInProcessPort(portName string, addr string) error {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+	t.inProcess.ports[portName] = u.Port()
+	return nil
+}
+
+// startCompose is the start of the in process api server, it runs with the session lock held
+func (t *TestCompose) startCompose(ctx context.Context) (err error) {
+	if t.inProcess.started {
+		return errors.New("compose is started")
+	}
+	t.inProcess.started = true
+	ctx, span := trace.Start(ctx, "start")
+	defer func() {
+		span.Finish(err)
+	}()
+	return t.compose.Start(ctx, t.agent)
+}
+
+// stopCompose is the stop of the in process api server, it runs with the session lock held
+func (t *TestCompose) stopCompose(ctx context.Context) error {
+	if !t.compose.IsReady() {
+		return errors.New("compose is not ready, can not use stop command")
+	}
+	t.compose.StopPods(ctx)
+	t.inProcess.started = false
+	return nil
+}
+
+func (t *TestCompose) shutdownInProcess(ctx context.Context) {
+	t.inProcess.shutdownOnce.Do(func() {
+		if t.inProcess.server != nil {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			_ = t.inProcess.server.Shutdown(ctx)
+		}
+		if t.inProcess.bus == nil {
+			return
+		}
+		t.compose.StopEventSinks()
+		_ = t.inProcess.bus.Close()
+		if event.Bus == t.inProcess.bus {
+			event.Bus = nil
+		}
+	})
+}
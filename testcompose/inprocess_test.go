@@ -0,0 +1,135 @@
+package testcompose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"podcompose/common"
+	"podcompose/docker"
+	"podcompose/docker/fake"
+	"strings"
+	"testing"
+	"time"
+)
+
+const inProcessConfig = `
+version: 1
+volumes:
+  - name: data
+    path: data
+pods:
+  - name: db
+    containers:
+      - name: db
+        image: mysql
+        volumeMounts:
+          - name: data
+            mountPath: /var/lib/mysql
+`
+
+func TestInProcess(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "data", "init.sql"), []byte("select 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, common.ConfigFileName), []byte(inProcessConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runtime := fake.NewRuntime()
+	t.Run("start", func(t *testing.T) {
+		testCompose, err := NewInProcessTestComposeWithRuntime(t, workspace, "s1", runtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		if err = testCompose.Start(ctx, true, false); err != nil {
+			t.Fatal(err)
+		}
+		client, err := testCompose.GetClient(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			info, err := client.Info(ctx)
+			if err == nil && info.IsReady {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("compose is not ready: %+v %v", info, err)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if files := runtime.VolumeFiles("data_s1"); string(files["init.sql"]) != "select 1" {
+			t.Fatalf("volume is not seeded: %v", files)
+		}
+		for _, name := range runtime.Started() {
+			if strings.Contains(name, "agent") {
+				t.Fatalf("agent container %s is started", name)
+			}
+		}
+
+		if err = testCompose.SnapshotVolume(ctx, "data", "clean"); err != nil {
+			t.Fatal(err)
+		}
+		if err = runtime.CopyToVolume(ctx, "data", "s1", docker.ArchiveFile("dirty.sql", []byte("select 2"), 0644)); err != nil {
+			t.Fatal(err)
+		}
+		if err = testCompose.RestoreVolume(ctx, "data", "clean"); err != nil {
+			t.Fatal(err)
+		}
+		if files := runtime.VolumeFiles("data_s1"); len(files) != 1 || string(files["init.sql"]) != "select 1" {
+			t.Fatalf("volume is not restored: %v", files)
+		}
+		starts := 0
+		for _, name := range runtime.Started() {
+			if name == common.ContainerNamePrefix+"db_db_s1" {
+				starts++
+			}
+		}
+		if starts != 2 {
+			t.Fatalf("pod using the volume should be restarted once: %d starts", starts)
+		}
+		if err = testCompose.RestoreVolume(ctx, "data", "missing"); err == nil {
+			t.Fatal("restore of a missing snapshot should fail")
+		}
+
+		archive, err := client.ExportVolume(ctx, "data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		exported := filepath.Join(t.TempDir(), "data")
+		err = docker.ExtractArchive(archive, exported)
+		_ = archive.Close()
+		if content, _ := os.ReadFile(filepath.Join(exported, "init.sql")); err != nil || string(content) != "select 1" {
+			t.Fatalf("volume is not exported: %q %v", content, err)
+		}
+		if _, err = client.ExportVolume(ctx, "missing"); err == nil {
+			t.Fatal("export of a missing volume should fail")
+		}
+		bundle := t.TempDir()
+		if err = testCompose.ExportVolumes(ctx, bundle); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"data", docker.SnapshotVolumeName("data", "clean")} {
+			if content, _ := os.ReadFile(filepath.Join(bundle, name, "init.sql")); string(content) != "select 1" {
+				t.Fatalf("volume %s is not in the bundle: %q", name, content)
+			}
+		}
+		if _, err = os.Stat(filepath.Join(bundle, common.SystemLogVolumeName)); !os.IsNotExist(err) {
+			t.Fatalf("system volumes should be left out of the bundle: %v", err)
+		}
+	})
+	if containers, _ := runtime.FindAllContainersWithSessionId(context.Background(), "s1"); len(containers) != 0 {
+		t.Fatalf("session is not cleaned: %d containers", len(containers))
+	}
+	if _, ok := runtime.Volume("data_s1"); ok {
+		t.Fatal("volume of the session is not removed")
+	}
+	if _, ok := runtime.Volume(docker.SnapshotVolumeName("data", "clean") + "_s1"); ok {
+		t.Fatal("snapshot of the session is not removed")
+	}
+}
@@ -8,9 +8,11 @@ import (
 	"go.uber.org/zap"
 	"os"
 	"path/filepath"
+	"podcompose/client"
 	"podcompose/common"
 	"podcompose/compose"
 	"podcompose/docker"
+	"podcompose/event"
 )
 
 type TestCompose struct {
@@ -18,6 +20,7 @@ type TestCompose struct {
 	compose        *compose.Compose
 	workspace      string
 	agentContainer docker.Container
+	inProcess      *inProcess
 }
 
 func NewTestComposeWithSessionId(workspace string, sessionId string) (*TestCompose, error) {
@@ -40,7 +43,7 @@ func (t *TestCompose) GetSessionId() string {
 	return t.compose.GetConfig().SessionId
 }
 func (t *TestCompose) verify(ctx context.Context) error {
-	containers, err := t.compose.GetDockerProvider().FindContainers(ctx, t.compose.GetConfig().SessionId)
+	containers, err := t.compose.GetRuntime().FindContainers(ctx, t.compose.GetConfig().SessionId)
 	if err != nil {
 		return err
 	}
@@ -63,9 +66,17 @@ func (t *TestCompose) Start(ctx context.Context, autoStart bool, bootInDocker bo
 	if err != nil {
 		return err
 	}
+	// a remote engine gets the context directory in a volume
+	if err = t.compose.ShipContext(ctx); err != nil {
+		return err
+	}
 	if !autoStart {
 		zap.L().Info("Auto Start is not enable, you need call agent start api to start compose")
 	}
+	if t.inProcess != nil {
+		zap.L().Info("Run agent service in process")
+		return t.startInProcess(ctx, autoStart)
+	}
 	if bootInDocker {
 		zap.L().Info("Boot agent service in docker container")
 	}
@@ -78,6 +89,12 @@ func (t *TestCompose) Start(ctx context.Context, autoStart bool, bootInDocker bo
 }
 
 func (t *TestCompose) GetPort(ctx context.Context, portName string) (string, error) {
+	if t.inProcess != nil {
+		if port, ok := t.inProcess.ports[portName]; ok {
+			return port, nil
+		}
+		return "", errors.New("can not found managed port")
+	}
 	ports, err := t.agentContainer.Ports(ctx)
 	if err != nil {
 		return "", err
@@ -94,6 +111,67 @@ func (t *TestCompose) GetPort(ctx context.Context, portName string) (string, err
 	return "", errors.New("can not found managed port")
 }
 
+// GetHost returns where the ports of GetPort are published, the engine machine when it is remote
+func (t *TestCompose) GetHost(ctx context.Context) (string, error) {
+	if t.inProcess != nil {
+		return "127.0.0.1", nil
+	}
+	if t.agentContainer == nil {
+		return "", errors.New("agent is not started")
+	}
+	return t.agentContainer.Host(ctx)
+}
+
+// GetClient returns a client of the agent management api, Start must be called before
+func (t *TestCompose) GetClient(ctx context.Context) (*client.Client, error) {
+	host, err := t.GetHost(ctx)
+	if err != nil {
+		return nil, err
+	}
+	port, err := t.GetPort(ctx, common.ServerAgentPort)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewClient(fmt.Sprintf("http://%s:%s", host, port)), nil
+}
+
+// SnapshotVolume copies the volume into the named snapshot, the pods keep running, Start must be called before
+func (t *TestCompose) SnapshotVolume(ctx context.Context, volumeName string, snapshot string) error {
+	c, err := t.GetClient(ctx)
+	if err != nil {
+		return err
+	}
+	return c.SnapshotVolume(ctx, volumeName, snapshot)
+}
+
+// RestoreVolume resets the volume to the named snapshot, only the pods using it are restarted
+func (t *TestCompose) RestoreVolume(ctx context.Context, volumeName string, snapshot string) error {
+	c, err := t.GetClient(ctx)
+	if err != nil {
+		return err
+	}
+	return c.RestoreVolume(ctx, volumeName, snapshot)
+}
+
+// ExportVolumes writes every volume of the session to dest, a directory or a .tar file, e.g. to keep the data of
+// a failed test, see docker.ExportVolumes
+func (t *TestCompose) ExportVolumes(ctx context.Context, dest string) error {
+	return docker.ExportVolumes(ctx, t.compose.GetRuntime(), t.GetSessionId(), dest, t.compose.GetVolumeSources())
+}
+
+// Subscribe delivers the events of the agent event bus, see event.Subscribe, Start must be called before
+func (t *TestCompose) Subscribe(ctx context.Context, topics ...string) (<-chan *event.EventMsg, error) {
+	host, err := t.GetHost(ctx)
+	if err != nil {
+		return nil, err
+	}
+	port, err := t.GetPort(ctx, common.ServerAgentEventBusPort)
+	if err != nil {
+		return nil, err
+	}
+	return event.Subscribe(ctx, fmt.Sprintf("%s:%s", host, port), topics...)
+}
+
 type AgentLogConsumer struct {
 }
 
@@ -102,6 +180,9 @@ func (a AgentLogConsumer) Accept(log docker.Log) {
 }
 
 func (t *TestCompose) ShowAgentLog(ctx context.Context) error {
+	if t.agentContainer == nil {
+		return errors.New("agent container is not started")
+	}
 	t.agentContainer.FollowOutput(&AgentLogConsumer{})
 	err := t.agentContainer.StartLogProducer(ctx)
 	if err != nil {
@@ -0,0 +1,182 @@
+package trace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+const ChromeTraceFileName = "trace.json"
+const OTLPFileName = "trace.otlp.json"
+const serviceName = "testcompose"
+
+type chromeTrace struct {
+	TraceEvents     []chromeEvent `json:"traceEvents"`
+	DisplayTimeUnit string        `json:"displayTimeUnit"`
+}
+
+type chromeEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat"`
+	Phase     string            `json:"ph"`
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur"`
+	Pid       int               `json:"pid"`
+	Tid       int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// ChromeTrace encodes the spans as a chrome trace_event json, it can be opened by chrome://tracing or perfetto
+func (r *Recorder) ChromeTrace() ([]byte, error) {
+	spans := r.Spans()
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	events := make([]chromeEvent, 0, len(spans))
+	for _, span := range spans {
+		args := make(map[string]string)
+		for k, v := range span.Attributes {
+			args[k] = v
+		}
+		if span.Error != "" {
+			args["error"] = span.Error
+		}
+		events = append(events, chromeEvent{
+			Name:      span.Name,
+			Category:  serviceName,
+			Phase:     "X",
+			Timestamp: span.Start.UnixMicro(),
+			Duration:  span.End.Sub(span.Start).Microseconds(),
+			Pid:       1,
+			Tid:       span.lane,
+			Args:      args,
+		})
+	}
+	return json.Marshal(&chromeTrace{
+		TraceEvents:     events,
+		DisplayTimeUnit: "ms",
+	})
+}
+
+type otlpTrace struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+// OTLP encodes the spans as an OTLP/JSON ExportTraceServiceRequest
+func (r *Recorder) OTLP() ([]byte, error) {
+	resourceAttributes := r.resourceAttributes()
+	resourceAttributes["service.name"] = serviceName
+	spans := r.Spans()
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		status := otlpStatus{Code: otlpStatusOk}
+		if span.Error != "" {
+			status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		otlpSpans = append(otlpSpans, otlpSpan{
+			TraceId:           span.TraceId,
+			SpanId:            span.SpanId,
+			ParentSpanId:      span.ParentId,
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        toOtlpAttributes(span.Attributes),
+			Status:            status,
+		})
+	}
+	return json.Marshal(&otlpTrace{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{Attributes: toOtlpAttributes(resourceAttributes)},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: "podcompose"},
+						Spans: otlpSpans,
+					},
+				},
+			},
+		},
+	})
+}
+
+// WriteFiles exports the spans in both formats into dir
+func (r *Recorder) WriteFiles(dir string) error {
+	chrome, err := r.ChromeTrace()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ChromeTraceFileName), chrome, 0766); err != nil {
+		return err
+	}
+	otlp, err := r.OTLP()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, OTLPFileName), otlp, 0766)
+}
+
+func toOtlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, otlpAttribute{Key: k, Value: otlpValue{StringValue: attributes[k]}})
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const maxSpans = 10000
+
+var DefaultRecorder = NewRecorder()
+
+type spanKey struct{}
+
+// Span records the duration of one phase, spans are nested through context.Context
+type Span struct {
+	TraceId    string
+	SpanId     string
+	ParentId   string
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Error      string
+	// lane groups the spans running sequentially, it is exported as the chrome trace thread id
+	lane     int
+	recorder *Recorder
+}
+
+// Recorder collects the finished spans of a session
+type Recorder struct {
+	lock    sync.Mutex
+	traceId string
+	lanes   int
+	spans   []*Span
+	attrs   map[string]string
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		traceId: newId(16),
+		spans:   make([]*Span, 0),
+		attrs:   make(map[string]string),
+	}
+}
+
+// SetResourceAttribute sets an attribute of the traced process, e.g. the session id
+func (r *Recorder) SetResourceAttribute(key string, value string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.attrs[key] = value
+}
+
+// Spans returns a copy of the finished spans
+func (r *Recorder) Spans() []Span {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	spans := make([]Span, len(r.spans))
+	for i, span := range r.spans {
+		spans[i] = *span
+		spans[i].Attributes = make(map[string]string, len(span.Attributes))
+		for k, v := range span.Attributes {
+			spans[i].Attributes[k] = v
+		}
+	}
+	return spans
+}
+
+func (r *Recorder) resourceAttributes() map[string]string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	attrs := make(map[string]string, len(r.attrs))
+	for k, v := range r.attrs {
+		attrs[k] = v
+	}
+	return attrs
+}
+
+func (r *Recorder) start(ctx context.Context, name string, newLane bool) *Span {
+	span := &Span{
+		TraceId:    r.traceId,
+		SpanId:     newId(8),
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: make(map[string]string),
+		recorder:   r,
+	}
+	parent := FromContext(ctx)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if parent != nil {
+		span.ParentId = parent.SpanId
+		span.lane = parent.lane
+	}
+	if newLane {
+		r.lanes++
+		span.lane = r.lanes
+	}
+	return span
+}
+
+func (r *Recorder) finish(span *Span, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	span.End = time.Now()
+	if err != nil {
+		span.Error = err.Error()
+	}
+	if len(r.spans) >= maxSpans {
+		return
+	}
+	r.spans = append(r.spans, span)
+}
+
+// Start begins a span with the DefaultRecorder, the span in ctx becomes its parent
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartWithRecorder(ctx, DefaultRecorder, name)
+}
+
+// StartLane begins a span that runs concurrently with its siblings, it and its children get their own lane
+func StartLane(ctx context.Context, name string) (context.Context, *Span) {
+	span := DefaultRecorder.start(ctx, name, true)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func StartWithRecorder(ctx context.Context, recorder *Recorder, name string) (context.Context, *Span) {
+	span := recorder.start(ctx, name, false)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SetAttribute sets an attribute of the span, the recorder lock guards it against the export of finished spans
+func (s *Span) SetAttribute(key string, value string) *Span {
+	s.recorder.lock.Lock()
+	defer s.recorder.lock.Unlock()
+	s.Attributes[key] = value
+	return s
+}
+
+// Finish ends the span, a non nil err marks the span as failed
+func (s *Span) Finish(err error) {
+	s.recorder.finish(s, err)
+}
+
+func newId(size int) string {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,81 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestRecorderExport(t *testing.T) {
+	recorder := NewRecorder()
+	recorder.SetResourceAttribute("session.id", "test")
+	ctx, root := StartWithRecorder(context.Background(), recorder, "start")
+	_, child := StartWithRecorder(ctx, recorder, "pull_image")
+	child.SetAttribute("container.image", "nginx").Finish(errors.New("not found"))
+	root.Finish(nil)
+
+	spans := recorder.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	if spans[0].ParentId != spans[1].SpanId || spans[0].TraceId != spans[1].TraceId {
+		t.Fatalf("child span is not linked to its parent")
+	}
+
+	chrome, err := recorder.ChromeTrace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chromeTrace chromeTrace
+	if err := json.Unmarshal(chrome, &chromeTrace); err != nil {
+		t.Fatal(err)
+	}
+	if len(chromeTrace.TraceEvents) != 2 || chromeTrace.TraceEvents[0].Name != "start" || chromeTrace.TraceEvents[0].Phase != "X" {
+		t.Fatalf("unexpected chrome trace: %s", chrome)
+	}
+	if chromeTrace.TraceEvents[1].Args["error"] != "not found" {
+		t.Fatalf("error is not exported: %s", chrome)
+	}
+
+	otlp, err := recorder.OTLP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var otlpTrace otlpTrace
+	if err := json.Unmarshal(otlp, &otlpTrace); err != nil {
+		t.Fatal(err)
+	}
+	otlpSpans := otlpTrace.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(otlpSpans) != 2 || otlpSpans[0].Status.Code != otlpStatusError || len(otlpSpans[0].TraceId) != 32 {
+		t.Fatalf("unexpected otlp trace: %s", otlp)
+	}
+	if len(otlpTrace.ResourceSpans[0].Resource.Attributes) != 2 {
+		t.Fatalf("unexpected otlp resource: %s", otlp)
+	}
+}
+
+func TestRecorderConcurrentExport(t *testing.T) {
+	recorder := NewRecorder()
+	_, span := StartWithRecorder(context.Background(), recorder, "start")
+	span.Finish(nil)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			span.SetAttribute("attempt", strconv.Itoa(i))
+			_, child := StartWithRecorder(context.Background(), recorder, "child")
+			child.Finish(nil)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := recorder.OTLP(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if spans := recorder.Spans(); spans[0].Attributes["attempt"] != "99" {
+		t.Fatalf("unexpected attributes: %v", spans[0].Attributes)
+	}
+}